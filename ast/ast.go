@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Position() token.Position
 }
 
 type Statement interface {
@@ -21,6 +22,22 @@ type Expression interface {
 	expressionNode()
 }
 
+// nodeString returns the source of n, or nothing for a node missing from a
+// program that failed to parse.
+func nodeString(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+func blockString(b *BlockStatement) string {
+	if b == nil {
+		return ""
+	}
+	return b.String()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -43,6 +60,14 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Position() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Position()
+	} else {
+		return token.Position{Line: 1, Column: 1}
+	}
+}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -72,6 +97,10 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Position() token.Position {
+	return ls.Token.Position
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -88,6 +117,10 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Position() token.Position {
+	return i.Token.Position
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -112,6 +145,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Position() token.Position {
+	return rs.Token.Position
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -131,6 +168,10 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Position() token.Position {
+	return es.Token.Position
+}
+
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
@@ -140,6 +181,10 @@ func (i *IntegerLiteral) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *IntegerLiteral) Position() token.Position {
+	return i.Token.Position
+}
+
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
@@ -157,8 +202,12 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Position() token.Position {
+	return pe.Token.Position
+}
+
 func (pe *PrefixExpression) String() string {
-	return "(" + pe.Operator + pe.Right.String() + ")"
+	return "(" + pe.Operator + nodeString(pe.Right) + ")"
 }
 
 func (pe *PrefixExpression) expressionNode() {
@@ -175,13 +224,17 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Position() token.Position {
+	return ie.Token.Position
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteRune('(')
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString(" " + ie.Operator + " ")
-	out.WriteString(ie.Right.String())
+	out.WriteString(nodeString(ie.Right))
 	out.WriteRune(')')
 
 	return out.String()
@@ -199,6 +252,10 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Position() token.Position {
+	return b.Token.Position
+}
+
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -214,6 +271,10 @@ func (n *Null) TokenLiteral() string {
 	return n.Token.Literal
 }
 
+func (n *Null) Position() token.Position {
+	return n.Token.Position
+}
+
 func (n *Null) String() string {
 	return n.Token.Literal
 }
@@ -237,6 +298,10 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Position() token.Position {
+	return sl.Token.Position
+}
+
 func (sl *StringLiteral) String() string {
 	return sl.Value
 }
@@ -248,19 +313,23 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Position() token.Position {
+	return ie.Token.Position
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("if")
-	out.WriteString(ie.Condition.String())
+	out.WriteString(nodeString(ie.Condition))
 	out.WriteString(" { ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(blockString(ie.Consequence))
 	out.WriteString(" }")
 
 	if ie.Alternative != nil {
 		out.WriteString(" else")
 		out.WriteString(" { ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(blockString(ie.Alternative))
 		out.WriteString(" }")
 	}
 
@@ -279,6 +348,10 @@ func (be *BlockStatement) TokenLiteral() string {
 	return be.Token.Literal
 }
 
+func (be *BlockStatement) Position() token.Position {
+	return be.Token.Position
+}
+
 func (be *BlockStatement) String() string {
 	var statements []string
 
@@ -302,6 +375,10 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Position() token.Position {
+	return fl.Token.Position
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	var params []string
@@ -312,7 +389,7 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString(fl.TokenLiteral() + "(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") { ")
-	out.WriteString(fl.Body.String())
+	out.WriteString(blockString(fl.Body))
 	out.WriteString(" }")
 
 	return out.String()
@@ -331,14 +408,18 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+func (ce *CallExpression) Position() token.Position {
+	return ce.Token.Position
+}
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	var arguments []string
 	for _, a := range ce.Arguments {
-		arguments = append(arguments, a.String())
+		arguments = append(arguments, nodeString(a))
 	}
 
-	out.WriteString(ce.Function.String())
+	out.WriteString(nodeString(ce.Function))
 	out.WriteRune('(')
 	out.WriteString(strings.Join(arguments, ", "))
 	out.WriteRune(')')
@@ -358,12 +439,16 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
+func (al *ArrayLiteral) Position() token.Position {
+	return al.Token.Position
+}
+
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	var elements []string
 
 	for _, e := range al.Elements {
-		elements = append(elements, e.String())
+		elements = append(elements, nodeString(e))
 	}
 
 	out.WriteRune('[')
@@ -386,13 +471,17 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Position() token.Position {
+	return ie.Token.Position
+}
+
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteRune('(')
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteRune('[')
-	out.WriteString(ie.Index.String())
+	out.WriteString(nodeString(ie.Index))
 	out.WriteString("])")
 
 	return out.String()
@@ -401,6 +490,51 @@ func (ie *IndexExpression) String() string {
 func (ie *IndexExpression) expressionNode() {
 }
 
+// SliceExpression is Left[Start:End:Step], where every bound is optional
+// and nil when omitted.
+type SliceExpression struct {
+	Token token.Token // the [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SliceExpression) Position() token.Position {
+	return se.Token.Position
+}
+
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	bound := func(e Expression) {
+		if e != nil {
+			out.WriteString(e.String())
+		}
+	}
+
+	out.WriteRune('(')
+	out.WriteString(nodeString(se.Left))
+	out.WriteRune('[')
+	bound(se.Start)
+	out.WriteRune(':')
+	bound(se.End)
+	if se.Step != nil {
+		out.WriteRune(':')
+		bound(se.Step)
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+func (se *SliceExpression) expressionNode() {
+}
+
 type MapLiteral struct {
 	Token token.Token // the { token
 	Pairs map[Expression]Expression
@@ -410,12 +544,16 @@ func (ml *MapLiteral) TokenLiteral() string {
 	return ml.Token.Literal
 }
 
+func (ml *MapLiteral) Position() token.Position {
+	return ml.Token.Position
+}
+
 func (ml *MapLiteral) String() string {
 	var out bytes.Buffer
 	var pairs []string
 
 	for k, v := range ml.Pairs {
-		pairs = append(pairs, k.String()+": "+v.String())
+		pairs = append(pairs, nodeString(k)+": "+nodeString(v))
 	}
 
 	out.WriteRune('{')
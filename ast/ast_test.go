@@ -2,6 +2,7 @@ package ast
 
 import (
 	"example.com/writing-an-interpreter/token"
+	"strings"
 	"testing"
 )
 
@@ -25,3 +26,34 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &IfExpression{
+					Condition:   ident("a"),
+					Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("b")}}},
+				},
+			},
+			&LetStatement{Name: ident("c"), Value: &CallExpression{Function: ident("d"), Arguments: []Expression{ident("e")}}},
+		},
+	}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		if i, ok := node.(*Identifier); ok {
+			visited = append(visited, i.Value)
+		}
+		_, isCall := node.(*CallExpression)
+		return !isCall
+	})
+
+	if strings.Join(visited, " ") != "a b c" {
+		t.Errorf("wrong identifiers visited. got=%q", visited)
+	}
+}
@@ -0,0 +1,102 @@
+package ast
+
+import "sort"
+
+// Inspect traverses the tree rooted at node in source order, calling f for
+// each node. The children of a node are skipped when f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+}
+
+func isNil(node Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return n == nil
+	case *Identifier:
+		return n == nil
+	case *FunctionLiteral:
+		return n == nil
+	default:
+		return false
+	}
+}
+
+// Children returns the nodes directly contained in node, in source order,
+// leaving out omitted ones such as a missing else branch.
+func Children(node Node) []Node {
+	var present []Node
+
+	for _, child := range children(node) {
+		if !isNil(child) {
+			present = append(present, child)
+		}
+	}
+
+	return present
+}
+
+func children(node Node) []Node {
+	var nodes []Node
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			nodes = append(nodes, s)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			nodes = append(nodes, s)
+		}
+	case *LetStatement:
+		nodes = append(nodes, n.Name, n.Value)
+	case *ReturnStatement:
+		nodes = append(nodes, n.ReturnValue)
+	case *ExpressionStatement:
+		nodes = append(nodes, n.Expression)
+	case *PrefixExpression:
+		nodes = append(nodes, n.Right)
+	case *InfixExpression:
+		nodes = append(nodes, n.Left, n.Right)
+	case *IfExpression:
+		nodes = append(nodes, n.Condition, n.Consequence, n.Alternative)
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			nodes = append(nodes, p)
+		}
+		nodes = append(nodes, n.Body)
+	case *CallExpression:
+		nodes = append(nodes, n.Function)
+		for _, a := range n.Arguments {
+			nodes = append(nodes, a)
+		}
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			nodes = append(nodes, e)
+		}
+	case *IndexExpression:
+		nodes = append(nodes, n.Left, n.Index)
+	case *SliceExpression:
+		nodes = append(nodes, n.Left, n.Start, n.End, n.Step)
+	case *MapLiteral:
+		var keys []Expression
+		for k := range n.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Position().Offset < keys[j].Position().Offset
+		})
+		for _, k := range keys {
+			nodes = append(nodes, k, n.Pairs[k])
+		}
+	}
+
+	return nodes
+}
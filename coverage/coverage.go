@@ -0,0 +1,282 @@
+package coverage
+
+import (
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type statementCount struct {
+	line  int
+	count int64
+}
+
+type branchCount struct {
+	line        int
+	hasElse     bool
+	consequence int64
+	alternative int64
+}
+
+type functionCount struct {
+	name  string
+	line  int
+	count int64
+}
+
+type file struct {
+	name       string
+	source     string
+	statements []*statementCount
+	branches   []*branchCount
+	functions  []*functionCount
+}
+
+// Collector records which statements, if branches and functions of the
+// programs added to it are executed. It implements evaluator.Tracer.
+type Collector struct {
+	files      []*file
+	statements map[ast.Statement]*statementCount
+	branches   map[*ast.IfExpression]*branchCount
+	functions  map[*ast.BlockStatement]*functionCount
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		statements: make(map[ast.Statement]*statementCount),
+		branches:   make(map[*ast.IfExpression]*branchCount),
+		functions:  make(map[*ast.BlockStatement]*functionCount),
+	}
+}
+
+// Add registers the statements, branches and functions of program, parsed
+// from the given source file, so that the ones never executed are reported.
+func (c *Collector) Add(filename string, source string, program *ast.Program) {
+	f := &file{name: filename, source: source}
+	c.files = append(c.files, f)
+	names := make(map[*ast.FunctionLiteral]string)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			if fn, ok := n.Value.(*ast.FunctionLiteral); ok && n.Name != nil {
+				names[fn] = n.Name.Value
+			}
+		case *ast.IfExpression:
+			b := &branchCount{line: n.Position().Line, hasElse: n.Alternative != nil}
+			f.branches = append(f.branches, b)
+			c.branches[n] = b
+		case *ast.FunctionLiteral:
+			name, ok := names[n]
+			if !ok {
+				name = fmt.Sprintf("<anonymous:%d>", n.Position().Line)
+			}
+			fc := &functionCount{name: name, line: n.Position().Line}
+			f.functions = append(f.functions, fc)
+			c.functions[n.Body] = fc
+		}
+
+		if statement, ok := node.(ast.Statement); ok {
+			if _, isBlock := statement.(*ast.BlockStatement); !isBlock {
+				s := &statementCount{line: statement.Position().Line}
+				f.statements = append(f.statements, s)
+				c.statements[statement] = s
+			}
+		}
+
+		return true
+	})
+}
+
+func (c *Collector) Statement(statement ast.Statement, _ *object.Environment) {
+	if s, ok := c.statements[statement]; ok {
+		s.count++
+	}
+}
+
+func (c *Collector) Call(_ *ast.CallExpression, fn object.Object, _ *object.Environment) {
+	if function, ok := fn.(*object.Function); ok {
+		if f, ok := c.functions[function.Body]; ok {
+			f.count++
+		}
+	}
+}
+
+func (c *Collector) Return(_ *ast.CallExpression, _ object.Object, _ object.Object) {
+}
+
+func (c *Collector) Branch(ie *ast.IfExpression, consequence bool) {
+	b, ok := c.branches[ie]
+	if !ok {
+		return
+	}
+
+	if consequence {
+		b.consequence++
+	} else {
+		b.alternative++
+	}
+}
+
+// lines returns the number of times each line holding a statement was
+// executed.
+func (f *file) lines() map[int]int64 {
+	lines := make(map[int]int64)
+	for _, s := range f.statements {
+		lines[s.line] = max(lines[s.line], s.count)
+	}
+	return lines
+}
+
+type summary struct {
+	statements, statementsHit int
+	branches, branchesHit     int
+	functions, functionsHit   int
+}
+
+func (f *file) summary() summary {
+	var s summary
+
+	for _, statement := range f.statements {
+		s.statements++
+		if statement.count > 0 {
+			s.statementsHit++
+		}
+	}
+
+	for _, b := range f.branches {
+		s.branches += 2
+		if b.consequence > 0 {
+			s.branchesHit++
+		}
+		if b.alternative > 0 {
+			s.branchesHit++
+		}
+	}
+
+	for _, fn := range f.functions {
+		s.functions++
+		if fn.count > 0 {
+			s.functionsHit++
+		}
+	}
+
+	return s
+}
+
+func percent(hit int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(hit) * 100 / float64(total)
+}
+
+// WriteSummary writes the percentage of statements, branches and functions
+// executed in each file, along with the lines that never were.
+func (c *Collector) WriteSummary(w io.Writer) error {
+	var out strings.Builder
+
+	for _, f := range c.files {
+		s := f.summary()
+		fmt.Fprintf(&out, "%s: %.1f%% of statements (%d/%d), %.1f%% of branches (%d/%d), %.1f%% of functions (%d/%d)\n",
+			f.name,
+			percent(s.statementsHit, s.statements), s.statementsHit, s.statements,
+			percent(s.branchesHit, s.branches), s.branchesHit, s.branches,
+			percent(s.functionsHit, s.functions), s.functionsHit, s.functions)
+
+		var missed []string
+		lines := f.lines()
+		for _, line := range sortedLines(lines) {
+			if lines[line] == 0 {
+				missed = append(missed, fmt.Sprint(line))
+			}
+		}
+		for _, b := range f.branches {
+			if b.consequence == 0 || b.alternative == 0 {
+				missed = append(missed, fmt.Sprintf("%d (%s)", b.line, branchMissed(b)))
+			}
+		}
+		for _, fn := range f.functions {
+			if fn.count == 0 {
+				missed = append(missed, fmt.Sprintf("%d (%s never called)", fn.line, fn.name))
+			}
+		}
+
+		if len(missed) > 0 {
+			fmt.Fprintf(&out, "  not covered: %s\n", strings.Join(missed, ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func branchMissed(b *branchCount) string {
+	switch {
+	case b.consequence == 0 && b.alternative == 0:
+		return "if never evaluated"
+	case b.consequence == 0:
+		return "if branch never taken"
+	case b.hasElse:
+		return "else branch never taken"
+	default:
+		return "condition never false"
+	}
+}
+
+func sortedLines(lines map[int]int64) []int {
+	var sorted []int
+	for line := range lines {
+		sorted = append(sorted, line)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
+
+// WriteLcov writes the coverage in the lcov tracefile format.
+func (c *Collector) WriteLcov(w io.Writer) error {
+	var out strings.Builder
+
+	for _, f := range c.files {
+		s := f.summary()
+		fmt.Fprintf(&out, "TN:\nSF:%s\n", f.name)
+
+		for _, fn := range f.functions {
+			fmt.Fprintf(&out, "FN:%d,%s\n", fn.line, fn.name)
+		}
+		for _, fn := range f.functions {
+			fmt.Fprintf(&out, "FNDA:%d,%s\n", fn.count, fn.name)
+		}
+		fmt.Fprintf(&out, "FNF:%d\nFNH:%d\n", s.functions, s.functionsHit)
+
+		for i, b := range f.branches {
+			evaluated := b.consequence+b.alternative > 0
+			fmt.Fprintf(&out, "BRDA:%d,%d,0,%s\n", b.line, i, branchTaken(b.consequence, evaluated))
+			fmt.Fprintf(&out, "BRDA:%d,%d,1,%s\n", b.line, i, branchTaken(b.alternative, evaluated))
+		}
+		fmt.Fprintf(&out, "BRF:%d\nBRH:%d\n", s.branches, s.branchesHit)
+
+		lines := f.lines()
+		hit := 0
+		for _, line := range sortedLines(lines) {
+			fmt.Fprintf(&out, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&out, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func branchTaken(count int64, evaluated bool) string {
+	if !evaluated {
+		return "-"
+	}
+	return fmt.Sprint(count)
+}
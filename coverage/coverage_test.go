@@ -0,0 +1,123 @@
+package coverage
+
+import (
+	"bytes"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"strings"
+	"testing"
+)
+
+const testProgram = `let abs = fn(x) {
+	if (x < 0) {
+		-x
+	} else {
+		x
+	}
+};
+let unused = fn() {
+	1
+};
+abs(5);`
+
+func testCollector(t *testing.T) *Collector {
+	p := parser.NewParser(lexer.NewLexer(testProgram))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	c := NewCollector()
+	c.Add("test.mnd", testProgram, program)
+	in := evaluator.NewInterpreter()
+	in.Tracer = c
+	in.Eval(program, object.NewEnvironment())
+
+	return c
+}
+
+func TestLineCounts(t *testing.T) {
+	lines := testCollector(t).files[0].lines()
+
+	expected := map[int]int64{1: 1, 2: 1, 3: 0, 5: 1, 8: 1, 9: 0, 11: 1}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong lines. expected=%v, got=%v", expected, lines)
+	}
+
+	for line, count := range expected {
+		if lines[line] != count {
+			t.Errorf("wrong count for line %d. expected=%d, got=%d", line, count, lines[line])
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var out bytes.Buffer
+	if err := testCollector(t).WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "test.mnd: 71.4% of statements (5/7), 50.0% of branches (1/2), 50.0% of functions (1/2)\n" +
+		"  not covered: 3, 9, 2 (if branch never taken), 8 (unused never called)\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong summary. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestLcov(t *testing.T) {
+	var out bytes.Buffer
+	if err := testCollector(t).WriteLcov(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `TN:
+SF:test.mnd
+FN:1,abs
+FN:8,unused
+FNDA:1,abs
+FNDA:0,unused
+FNF:2
+FNH:1
+BRDA:2,0,0,0
+BRDA:2,0,1,1
+BRF:2
+BRH:1
+DA:1,1
+DA:2,1
+DA:3,0
+DA:5,1
+DA:8,1
+DA:9,0
+DA:11,1
+LF:7
+LH:5
+end_of_record
+`
+
+	if out.String() != expected {
+		t.Errorf("wrong lcov output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := testCollector(t).WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	html := out.String()
+	for _, expected := range []string{
+		`<span class="line uncovered"><span class="number">3</span> <span class="count">0</span>		-x</span>`,
+		`<span class="line "><span class="number">7</span> <span class="count"></span>};</span>`,
+		`<span class="line covered"><span class="number">5</span> <span class="count">1</span>		x</span>`,
+		`<span class="line partial"><span class="number">2</span> <span class="count">1</span>	if (x &lt; 0) {</span>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("HTML report does not contain %q", expected)
+		}
+	}
+}
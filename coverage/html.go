@@ -0,0 +1,96 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mandrill coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; line-height: 1.4; }
+.line { display: block; }
+.number, .count { display: inline-block; color: #888; text-align: right; }
+.number { width: 4em; }
+.count { width: 5em; margin-right: 1em; }
+.covered { background: #dfd; }
+.uncovered { background: #fdd; }
+.partial { background: #ffc; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2>{{.Name}}</h2>
+<p>{{.Summary}}</p>
+<pre>{{range .Lines}}<span class="line {{.Class}}"><span class="number">{{.Number}}</span> <span class="count">{{.Count}}</span>{{.Text}}</span>{{end}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+type htmlLine struct {
+	Number int
+	Count  string
+	Class  string
+	Text   string
+}
+
+type htmlFile struct {
+	Name    string
+	Summary string
+	Lines   []htmlLine
+}
+
+// WriteHTML writes the source of each file with every line highlighted
+// according to whether it was executed.
+func (c *Collector) WriteHTML(w io.Writer) error {
+	var files []htmlFile
+
+	for _, f := range c.files {
+		s := f.summary()
+		counts := f.lines()
+
+		partial := make(map[int]bool)
+		for _, b := range f.branches {
+			if b.consequence == 0 || b.alternative == 0 {
+				partial[b.line] = true
+			}
+		}
+
+		hf := htmlFile{
+			Name: f.name,
+			Summary: fmt.Sprintf("%.1f%% of statements, %.1f%% of branches, %.1f%% of functions",
+				percent(s.statementsHit, s.statements),
+				percent(s.branchesHit, s.branches),
+				percent(s.functionsHit, s.functions)),
+		}
+
+		for i, text := range strings.Split(f.source, "\n") {
+			line := htmlLine{Number: i + 1, Text: text}
+
+			if count, ok := counts[i+1]; ok {
+				line.Count = fmt.Sprint(count)
+				switch {
+				case count == 0:
+					line.Class = "uncovered"
+				case partial[i+1]:
+					line.Class = "partial"
+				default:
+					line.Class = "covered"
+				}
+			}
+
+			hf.Lines = append(hf.Lines, line)
+		}
+
+		files = append(files, hf)
+	}
+
+	return htmlTemplate.Execute(w, files)
+}
@@ -0,0 +1,634 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/debugger"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const threadID = 1
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex
+	seq     int
+
+	mu               sync.Mutex
+	session          *debugger.Session
+	source           Source
+	stopOnEntry      bool
+	breakpoints      []int
+	running          bool
+	terminateOnStop  bool
+	handles          []any // the environments and objects behind each variables reference
+	pendingStep      func(*debugger.Session) debugger.Event
+	runner           sync.WaitGroup
+	disconnected     bool
+	configurationSet bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out}
+}
+
+// Serve handles requests until the client disconnects or closes the input.
+func (s *Server) Serve() error {
+	defer s.runner.Wait()
+
+	for {
+		body, err := s.readMessage()
+
+		if errors.Is(err, io.EOF) {
+			s.disconnect()
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var req request
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+
+		result, err := s.handle(req)
+
+		if err != nil {
+			if err := s.respond(req, false, err.Error(), nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.respond(req, true, "", result); err != nil {
+			return err
+		}
+
+		if err := s.afterResponse(req.Command); err != nil {
+			return err
+		}
+
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *Server) readMessage() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (s *Server) write(build func(seq int) any) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	body, err := json.Marshal(build(s.seq))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) respond(req request, success bool, message string, body any) error {
+	return s.write(func(seq int) any {
+		return response{
+			Seq:        seq,
+			Type:       "response",
+			RequestSeq: req.Seq,
+			Success:    success,
+			Command:    req.Command,
+			Message:    message,
+			Body:       body,
+		}
+	})
+}
+
+func (s *Server) sendEvent(name string, body any) error {
+	return s.write(func(seq int) any {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// OutputWriter returns a writer whose output is shown in the client's
+// debug console.
+func (s *Server) OutputWriter() io.Writer {
+	return outputWriter{s}
+}
+
+type outputWriter struct {
+	server *Server
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	err := w.server.sendEvent("output", OutputEventBody{Category: "stdout", Output: string(p)})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func decode[T any](raw json.RawMessage) (T, error) {
+	var arguments T
+
+	if len(raw) == 0 {
+		return arguments, nil
+	}
+
+	err := json.Unmarshal(raw, &arguments)
+	return arguments, err
+}
+
+func (s *Server) handle(req request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		arguments, err := decode[LaunchArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.launch(arguments)
+	case "setBreakpoints":
+		arguments, err := decode[SetBreakpointsArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(arguments), nil
+	case "configurationDone":
+		return nil, s.configurationDone()
+	case "threads":
+		return map[string]any{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		arguments, err := decode[ScopesArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.scopes(arguments)
+	case "variables":
+		arguments, err := decode[VariablesArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.variables(arguments)
+	case "evaluate":
+		arguments, err := decode[EvaluateArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.evaluate(arguments)
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.resume(func(session *debugger.Session) debugger.Event {
+			return session.Continue()
+		})
+	case "next":
+		return nil, s.resume(func(session *debugger.Session) debugger.Event {
+			return session.StepOver()
+		})
+	case "stepIn":
+		return nil, s.resume(func(session *debugger.Session) debugger.Event {
+			return session.StepInto()
+		})
+	case "stepOut":
+		return nil, s.resume(func(session *debugger.Session) debugger.Event {
+			return session.StepOut()
+		})
+	case "pause":
+		return nil, s.pause()
+	case "terminate", "disconnect":
+		s.disconnect()
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request: %s", req.Command)
+	}
+}
+
+func (s *Server) afterResponse(command string) error {
+	switch command {
+	case "initialize":
+		return s.sendEvent("initialized", nil)
+	case "configurationDone":
+		s.mu.Lock()
+		session, stopOnEntry := s.session, s.stopOnEntry
+		s.mu.Unlock()
+
+		if session == nil {
+			return nil
+		}
+
+		return s.run(func(session *debugger.Session) debugger.Event {
+			return session.Start(stopOnEntry)
+		})
+	case "continue", "next", "stepIn", "stepOut":
+		s.mu.Lock()
+		step := s.pendingStep
+		s.pendingStep = nil
+		s.mu.Unlock()
+
+		return s.run(step)
+	default:
+		return nil
+	}
+}
+
+func (s *Server) launch(arguments LaunchArguments) error {
+	var capabilities object.Capability
+
+	for _, name := range arguments.Allow {
+		c, ok := object.ParseCapability(name)
+		if !ok {
+			return fmt.Errorf("unknown capability %q", name)
+		}
+		capabilities |= c
+	}
+
+	source, err := os.ReadFile(arguments.Program)
+
+	if err != nil {
+		return err
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, d.Error())
+		}
+		return errors.New("parser errors: " + strings.Join(messages, "; "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.session = debugger.NewSession(program, object.NewEnvironment())
+	s.session.SetOutput(s.OutputWriter())
+	s.session.SetCapabilities(capabilities)
+	s.session.SetBreakpoints(s.breakpoints)
+	s.stopOnEntry = arguments.StopOnEntry
+	s.source = Source{Name: filepath.Base(arguments.Program), Path: arguments.Program}
+	return nil
+}
+
+func (s *Server) setBreakpoints(arguments SetBreakpointsArguments) map[string]any {
+	var lines []int
+	breakpoints := []Breakpoint{}
+
+	for _, bp := range arguments.Breakpoints {
+		lines = append(lines, bp.Line)
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: bp.Line})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.breakpoints = lines
+	if s.session != nil {
+		s.session.SetBreakpoints(lines)
+	}
+
+	return map[string]any{"breakpoints": breakpoints}
+}
+
+func (s *Server) configurationDone() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == nil {
+		return errors.New("no program has been launched")
+	}
+
+	if s.configurationSet {
+		return errors.New("the program has already started")
+	}
+
+	s.configurationSet = true
+	return nil
+}
+
+func (s *Server) pausedSession() (*debugger.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.session == nil || !s.configurationSet:
+		return nil, errors.New("the program is not running")
+	case s.running:
+		return nil, errors.New("the program is not paused")
+	case s.session.Exited():
+		return nil, errors.New("the program has exited")
+	default:
+		return s.session, nil
+	}
+}
+
+// resume makes the program take a step once the response to the request
+// has been sent, as the client expects it before the stopped event.
+func (s *Server) resume(step func(*debugger.Session) debugger.Event) error {
+	if _, err := s.pausedSession(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingStep = step
+	return nil
+}
+
+// run steps the program on its own goroutine, reporting where it stops.
+func (s *Server) run(step func(*debugger.Session) debugger.Event) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("the program is already running")
+	}
+	s.running = true
+	s.handles = nil
+	session := s.session
+	s.runner.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.runner.Done()
+
+		e := step(session)
+
+		s.mu.Lock()
+		s.running = false
+		terminate := s.terminateOnStop
+		s.mu.Unlock()
+
+		if terminate && e.Reason != debugger.StopExited {
+			e = session.Terminate()
+		}
+
+		_ = s.report(e)
+	}()
+
+	return nil
+}
+
+func (s *Server) report(e debugger.Event) error {
+	if e.Reason != debugger.StopExited {
+		return s.sendEvent("stopped", StoppedEventBody{
+			Reason:            string(e.Reason),
+			ThreadID:          threadID,
+			AllThreadsStopped: true,
+		})
+	}
+
+	exitCode := 0
+
+	if err, ok := e.Result.(*object.Error); ok {
+		exitCode = 1
+		if err := s.sendEvent("output", OutputEventBody{Category: "stderr", Output: err.Inspect() + "\n"}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.sendEvent("exited", ExitedEventBody{ExitCode: exitCode}); err != nil {
+		return err
+	}
+
+	return s.sendEvent("terminated", nil)
+}
+
+func (s *Server) pause() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == nil || !s.running {
+		return nil
+	}
+
+	s.session.Pause()
+	return nil
+}
+
+func (s *Server) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.disconnected || s.session == nil || !s.configurationSet {
+		s.disconnected = true
+		return
+	}
+
+	s.disconnected = true
+
+	if s.running {
+		s.terminateOnStop = true
+		s.session.Pause()
+		return
+	}
+
+	if !s.session.Exited() {
+		session := s.session
+		s.runner.Add(1)
+		go func() {
+			defer s.runner.Done()
+			_ = s.report(session.Terminate())
+		}()
+	}
+}
+
+func (s *Server) stackTrace() (any, error) {
+	session, err := s.pausedSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []StackFrame
+
+	for i, frame := range session.Stack() {
+		frames = append(frames, StackFrame{
+			ID:     i + 1,
+			Name:   frame.Name,
+			Source: s.source,
+			Line:   frame.Line,
+			Column: 1,
+		})
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) frame(id int) (debugger.Frame, error) {
+	session, err := s.pausedSession()
+	if err != nil {
+		return debugger.Frame{}, err
+	}
+
+	stack := session.Stack()
+
+	if id < 1 || id > len(stack) {
+		return debugger.Frame{}, fmt.Errorf("no such frame: %d", id)
+	}
+
+	return stack[id-1], nil
+}
+
+func (s *Server) newHandle(value any) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, value)
+	return len(s.handles)
+}
+
+func (s *Server) scopes(arguments ScopesArguments) (any, error) {
+	frame, err := s.frame(arguments.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []Scope
+
+	for env := frame.Environment; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case env == frame.Environment:
+			name = "Locals"
+		}
+
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.newHandle(env)})
+	}
+
+	return map[string]any{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(arguments VariablesArguments) (any, error) {
+	if _, err := s.pausedSession(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	ref := arguments.VariablesReference
+	if ref < 1 || ref > len(s.handles) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("invalid variables reference: %d", ref)
+	}
+	value := s.handles[ref-1]
+	s.mu.Unlock()
+
+	variables := []Variable{}
+
+	switch v := value.(type) {
+	case *object.Environment:
+		bindings := v.Bindings()
+		var names []string
+		for name := range bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			variables = append(variables, s.variable(name, bindings[name]))
+		}
+	case *object.Array:
+		for i, element := range v.Elements {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Map:
+		for _, pair := range v.Pairs {
+			variables = append(variables, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+		sort.Slice(variables, func(i, j int) bool {
+			return variables[i].Name < variables[j].Name
+		})
+	}
+
+	return map[string]any{"variables": variables}, nil
+}
+
+func (s *Server) variable(name string, value object.Object) Variable {
+	variable := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+
+	switch v := value.(type) {
+	case *object.Array:
+		if len(v.Elements) > 0 {
+			variable.VariablesReference = s.newHandle(v)
+		}
+	case *object.Map:
+		if len(v.Pairs) > 0 {
+			variable.VariablesReference = s.newHandle(v)
+		}
+	}
+
+	return variable
+}
+
+func (s *Server) evaluate(arguments EvaluateArguments) (any, error) {
+	session, err := s.pausedSession()
+	if err != nil {
+		return nil, err
+	}
+
+	frame := 0
+	if arguments.FrameID != nil {
+		frame = *arguments.FrameID - 1
+	}
+
+	result := session.Evaluate(arguments.Expression, frame)
+
+	if result == nil {
+		return map[string]any{"result": "", "variablesReference": 0}, nil
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	variable := s.variable("", result)
+	return map[string]any{
+		"result":             variable.Value,
+		"type":               variable.Type,
+		"variablesReference": variable.VariablesReference,
+	}, nil
+}
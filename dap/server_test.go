@@ -0,0 +1,307 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const testProgram = `let inc = fn(x) {
+	let y = x + 1;
+	y
+};
+let values = [1, 2];
+let a = inc(values[0]);
+a`
+
+type testClient struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	events []map[string]any
+}
+
+func newTestClient(t *testing.T) (*testClient, chan error) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := NewServer(serverReader, serverWriter).Serve()
+		_ = serverWriter.Close()
+		done <- err
+	}()
+
+	return &testClient{t: t, w: clientWriter, r: bufio.NewReader(clientReader)}, done
+}
+
+func (c *testClient) send(command string, arguments any) int {
+	c.seq++
+	body, _ := json.Marshal(map[string]any{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": arguments,
+	})
+
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("could not send %s request: %v", command, err)
+	}
+
+	return c.seq
+}
+
+func (c *testClient) read() map[string]any {
+	c.t.Helper()
+
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("could not read message header: %v", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("invalid Content-Length header: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.t.Fatalf("could not read message body: %v", err)
+	}
+
+	var msg map[string]any
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("could not decode message %s: %v", body, err)
+	}
+
+	return msg
+}
+
+// request sends a request and returns the body of its successful response,
+// keeping any event received in the meantime.
+func (c *testClient) request(command string, arguments any) map[string]any {
+	c.t.Helper()
+	seq := c.send(command, arguments)
+
+	for {
+		msg := c.read()
+
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+
+		if msg["request_seq"] != float64(seq) {
+			c.t.Fatalf("unexpected response: %v", msg)
+		}
+
+		if msg["success"] != true {
+			c.t.Fatalf("%s request failed: %v", command, msg["message"])
+		}
+
+		body, _ := msg["body"].(map[string]any)
+		return body
+	}
+}
+
+func (c *testClient) expectEvent(name string) map[string]any {
+	c.t.Helper()
+
+	for len(c.events) == 0 {
+		c.events = append(c.events, c.read())
+	}
+
+	e := c.events[0]
+	c.events = c.events[1:]
+
+	if e["type"] != "event" || e["event"] != name {
+		c.t.Fatalf("expected %s event. got=%v", name, e)
+	}
+
+	body, _ := e["body"].(map[string]any)
+	return body
+}
+
+func TestDebugSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mnd")
+	if err := os.WriteFile(path, []byte(testProgram), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, done := newTestClient(t)
+
+	capabilities := c.request("initialize", map[string]any{"adapterID": "mandrill"})
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("configurationDone request not supported. got=%v", capabilities)
+	}
+	c.expectEvent("initialized")
+
+	c.request("launch", map[string]any{"program": path})
+
+	breakpoints := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": path},
+		"breakpoints": []map[string]any{{"line": 3}},
+	})
+	if fmt.Sprint(breakpoints["breakpoints"]) != "[map[line:3 verified:true]]" {
+		t.Errorf("wrong breakpoints. got=%v", breakpoints["breakpoints"])
+	}
+
+	c.request("configurationDone", nil)
+
+	if stopped := c.expectEvent("stopped"); stopped["reason"] != "breakpoint" {
+		t.Fatalf("wrong stop reason. got=%v", stopped)
+	}
+
+	threads := c.request("threads", nil)
+	if fmt.Sprint(threads["threads"]) != "[map[id:1 name:main]]" {
+		t.Errorf("wrong threads. got=%v", threads["threads"])
+	}
+
+	stack := c.request("stackTrace", map[string]any{"threadId": 1})
+	frames := stack["stackFrames"].([]any)
+	if len(frames) != 2 {
+		t.Fatalf("wrong number of frames. got=%v", frames)
+	}
+	top := frames[0].(map[string]any)
+	if top["name"] != "inc" || top["line"] != float64(3) {
+		t.Errorf("wrong top frame. got=%v", top)
+	}
+
+	scopes := c.request("scopes", map[string]any{"frameId": top["id"]})["scopes"].([]any)
+	if len(scopes) != 2 {
+		t.Fatalf("wrong number of scopes. got=%v", scopes)
+	}
+	locals := scopes[0].(map[string]any)
+	globals := scopes[1].(map[string]any)
+	if locals["name"] != "Locals" || globals["name"] != "Globals" {
+		t.Errorf("wrong scopes. got=%v", scopes)
+	}
+
+	variables := c.request("variables", map[string]any{"variablesReference": locals["variablesReference"]})
+	if fmt.Sprint(variables["variables"]) != "[map[name:x type:INTEGER value:1 variablesReference:0] map[name:y type:INTEGER value:2 variablesReference:0]]" {
+		t.Errorf("wrong local variables. got=%v", variables["variables"])
+	}
+
+	var valuesReference any
+	for _, v := range c.request("variables", map[string]any{"variablesReference": globals["variablesReference"]})["variables"].([]any) {
+		if variable := v.(map[string]any); variable["name"] == "values" {
+			valuesReference = variable["variablesReference"]
+		}
+	}
+	elements := c.request("variables", map[string]any{"variablesReference": valuesReference})
+	if fmt.Sprint(elements["variables"]) != "[map[name:[0] type:INTEGER value:1 variablesReference:0] map[name:[1] type:INTEGER value:2 variablesReference:0]]" {
+		t.Errorf("wrong array elements. got=%v", elements["variables"])
+	}
+
+	evaluated := c.request("evaluate", map[string]any{"expression": "y * 10", "frameId": top["id"]})
+	if evaluated["result"] != "20" {
+		t.Errorf("wrong evaluation. got=%v", evaluated)
+	}
+
+	c.request("next", map[string]any{"threadId": 1})
+	c.expectEvent("stopped")
+	stack = c.request("stackTrace", map[string]any{"threadId": 1})
+	if top := stack["stackFrames"].([]any)[0].(map[string]any); top["name"] != "<main>" || top["line"] != float64(7) {
+		t.Errorf("wrong frame after stepping. got=%v", top)
+	}
+
+	c.request("continue", map[string]any{"threadId": 1})
+	if exited := c.expectEvent("exited"); exited["exitCode"] != float64(0) {
+		t.Errorf("wrong exit code. got=%v", exited)
+	}
+	c.expectEvent("terminated")
+
+	c.request("disconnect", nil)
+
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned an error: %v", err)
+	}
+}
+
+func TestDisconnectWhilePaused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mnd")
+	if err := os.WriteFile(path, []byte(testProgram), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, done := newTestClient(t)
+	c.request("initialize", nil)
+	c.expectEvent("initialized")
+	c.request("launch", map[string]any{"program": path, "stopOnEntry": true})
+	c.request("configurationDone", nil)
+
+	if stopped := c.expectEvent("stopped"); stopped["reason"] != "entry" {
+		t.Fatalf("wrong stop reason. got=%v", stopped)
+	}
+
+	c.request("disconnect", nil)
+	c.expectEvent("exited")
+	c.expectEvent("terminated")
+
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned an error: %v", err)
+	}
+}
+
+func TestProgramOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mnd")
+	if err := os.WriteFile(path, []byte(`print("hello", 1)`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, done := newTestClient(t)
+	c.request("initialize", nil)
+	c.expectEvent("initialized")
+	c.request("launch", map[string]any{"program": path})
+	c.request("configurationDone", nil)
+
+	if output := c.expectEvent("output"); output["category"] != "stdout" || output["output"] != "hello 1\n" {
+		t.Errorf("wrong output event. got=%v", output)
+	}
+
+	c.expectEvent("exited")
+	c.expectEvent("terminated")
+	c.request("disconnect", nil)
+
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned an error: %v", err)
+	}
+}
+
+func TestLaunchCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mnd")
+	if err := os.WriteFile(path, []byte(`print(now() > 0)`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, done := newTestClient(t)
+	c.request("initialize", nil)
+	c.expectEvent("initialized")
+
+	seq := c.send("launch", map[string]any{"program": path, "allow": []string{"time"}})
+	if response := c.read(); response["request_seq"] != float64(seq) || response["success"] != false {
+		t.Errorf("expected launching with an unknown capability to fail. got=%v", response)
+	}
+
+	c.request("launch", map[string]any{"program": path, "allow": []string{"clock"}})
+	c.request("configurationDone", nil)
+
+	if output := c.expectEvent("output"); output["output"] != "true\n" {
+		t.Errorf("wrong output event. got=%v", output)
+	}
+
+	c.expectEvent("exited")
+	c.expectEvent("terminated")
+	c.request("disconnect", nil)
+
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned an error: %v", err)
+	}
+}
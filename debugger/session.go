@@ -0,0 +1,380 @@
+package debugger
+
+import (
+	"errors"
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+	StopExited     StopReason = "exited"
+)
+
+type Event struct {
+	Reason StopReason
+	Line   int
+	Result object.Object // the result of the program, once it has exited
+}
+
+type Frame struct {
+	Name        string
+	Line        int // line of the statement being evaluated
+	Call        *ast.CallExpression
+	Environment *object.Environment
+}
+
+type stepMode int
+
+const (
+	runToBreakpoint stepMode = iota
+	stepInto
+	stepOver
+	stepOut
+)
+
+var errTerminated = errors.New("debug session terminated")
+
+// Session runs a program on its own goroutine, pausing it at breakpoints and
+// after steps. Its frames may only be inspected while the program is paused.
+type Session struct {
+	program     *ast.Program
+	env         *object.Environment
+	interpreter *evaluator.Interpreter
+
+	mu             sync.Mutex
+	breakpoints    map[int]bool
+	pauseRequested bool
+	stopOnEntry    bool
+	terminated     bool
+
+	mode      stepMode
+	stepDepth int
+	frames    []*Frame
+
+	started bool
+	exited  *Event
+	events  chan Event
+	resume  chan struct{}
+}
+
+func NewSession(program *ast.Program, env *object.Environment) *Session {
+	s := &Session{
+		program:     program,
+		env:         env,
+		breakpoints: make(map[int]bool),
+		frames:      []*Frame{{Name: "<main>", Environment: env}},
+		events:      make(chan Event),
+		resume:      make(chan struct{}),
+	}
+	s.interpreter = evaluator.NewInterpreter()
+	s.interpreter.Tracer = &tracer{session: s}
+	return s
+}
+
+// SetOutput sets where the program prints, os.Stdout by default. It must be
+// called before Start.
+func (s *Session) SetOutput(w io.Writer) {
+	s.interpreter.Out = w
+}
+
+// SetCapabilities grants capabilities to the program and to the expressions
+// evaluated in its frames, which have none by default. It must be called
+// before Start.
+func (s *Session) SetCapabilities(c object.Capability) {
+	s.interpreter.Capabilities = c
+}
+
+// Start runs the program until it first stops, pausing before its first
+// statement if stopOnEntry is set.
+func (s *Session) Start(stopOnEntry bool) Event {
+	s.mu.Lock()
+	s.stopOnEntry = stopOnEntry
+	s.started = true
+	s.mu.Unlock()
+
+	go s.run()
+	return s.wait()
+}
+
+func (s *Session) run() {
+	result := func() (result object.Object) {
+		// A bug of the interpreter ends the program with an error, not the
+		// debugger.
+		defer func() {
+			if r := recover(); r != nil {
+				if r == errTerminated {
+					result = nil
+				} else {
+					result = &object.Error{Message: fmt.Sprintf("internal error: %v", r)}
+				}
+			}
+		}()
+		return s.interpreter.Eval(s.program, s.env)
+	}()
+
+	s.events <- Event{Reason: StopExited, Result: result}
+}
+
+func (s *Session) wait() Event {
+	if exited := s.exitEvent(); exited != nil {
+		return *exited
+	}
+
+	event := <-s.events
+	if event.Reason == StopExited {
+		s.mu.Lock()
+		s.exited = &event
+		s.mu.Unlock()
+	}
+
+	return event
+}
+
+func (s *Session) exitEvent() *Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exited
+}
+
+func (s *Session) Continue() Event {
+	return s.resumeWith(runToBreakpoint)
+}
+
+func (s *Session) StepInto() Event {
+	return s.resumeWith(stepInto)
+}
+
+func (s *Session) StepOver() Event {
+	return s.resumeWith(stepOver)
+}
+
+func (s *Session) StepOut() Event {
+	return s.resumeWith(stepOut)
+}
+
+func (s *Session) resumeWith(mode stepMode) Event {
+	if !s.started {
+		s.mu.Lock()
+		s.mode = mode
+		s.mu.Unlock()
+		return s.Start(mode == stepInto)
+	}
+
+	if exited := s.exitEvent(); exited != nil {
+		return *exited
+	}
+
+	s.mu.Lock()
+	s.mode = mode
+	s.stepDepth = len(s.frames)
+	s.mu.Unlock()
+
+	s.resume <- struct{}{}
+	return s.wait()
+}
+
+// Pause makes a running program stop before its next statement.
+func (s *Session) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pauseRequested = true
+}
+
+// Terminate aborts a paused program, making it exit without a result.
+func (s *Session) Terminate() Event {
+	if !s.started || s.Exited() {
+		return Event{Reason: StopExited}
+	}
+
+	s.mu.Lock()
+	s.terminated = true
+	s.mu.Unlock()
+
+	s.resume <- struct{}{}
+	return s.wait()
+}
+
+func (s *Session) Exited() bool {
+	return s.exitEvent() != nil
+}
+
+func (s *Session) SetBreakpoint(line int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints[line] = true
+}
+
+func (s *Session) ClearBreakpoint(line int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.breakpoints, line)
+}
+
+// SetBreakpoints replaces every breakpoint with the given lines.
+func (s *Session) SetBreakpoints(lines []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = make(map[int]bool)
+	for _, line := range lines {
+		s.breakpoints[line] = true
+	}
+}
+
+func (s *Session) Breakpoints() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines []int
+	for line := range s.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Stack returns the frames of the paused program, innermost first.
+func (s *Session) Stack() []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stack := make([]Frame, len(s.frames))
+	for i, frame := range s.frames {
+		stack[len(s.frames)-1-i] = *frame
+	}
+	return stack
+}
+
+// Evaluate evaluates source in the environment of the given frame, where 0
+// is the innermost one.
+func (s *Session) Evaluate(source string, frame int) object.Object {
+	stack := s.Stack()
+	if frame < 0 || frame >= len(stack) {
+		return &object.Error{Message: "no such frame"}
+	}
+
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, d.Error())
+		}
+		return &object.Error{Message: strings.Join(messages, "; ")}
+	}
+
+	in := evaluator.NewInterpreter()
+	in.Out = s.interpreter.Out
+	in.Capabilities = s.interpreter.Capabilities
+	return in.Eval(program, stack[frame].Environment)
+}
+
+func (s *Session) shouldStop(line int, lineChanged bool) (StopReason, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depth := len(s.frames)
+
+	switch {
+	case s.stopOnEntry:
+		s.stopOnEntry = false
+		return StopEntry, true
+	case s.pauseRequested:
+		s.pauseRequested = false
+		return StopPause, true
+	case s.mode == stepInto && (lineChanged || depth != s.stepDepth):
+		return StopStep, true
+	case s.mode == stepOver && (depth < s.stepDepth || depth == s.stepDepth && lineChanged):
+		return StopStep, true
+	case s.mode == stepOut && depth < s.stepDepth:
+		return StopStep, true
+	case s.breakpoints[line] && lineChanged:
+		return StopBreakpoint, true
+	default:
+		return "", false
+	}
+}
+
+func (s *Session) stop(reason StopReason, line int) {
+	s.events <- Event{Reason: reason, Line: line}
+	<-s.resume
+
+	s.mu.Lock()
+	terminated := s.terminated
+	s.mu.Unlock()
+
+	if terminated {
+		panic(errTerminated)
+	}
+}
+
+type tracer struct {
+	session *Session
+}
+
+func (t *tracer) Statement(statement ast.Statement, env *object.Environment) {
+	s := t.session
+	line := statement.Position().Line
+
+	s.mu.Lock()
+	frame := s.frames[len(s.frames)-1]
+	lineChanged := frame.Line != line
+	frame.Line = line
+	frame.Environment = env
+	s.mu.Unlock()
+
+	if reason, ok := s.shouldStop(line, lineChanged); ok {
+		s.stop(reason, line)
+	}
+}
+
+func (t *tracer) Call(call *ast.CallExpression, fn object.Object, env *object.Environment) {
+	if env == nil {
+		return
+	}
+
+	s := t.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = append(s.frames, &Frame{Name: functionName(call), Call: call, Environment: env})
+}
+
+func (t *tracer) Return(_ *ast.CallExpression, fn object.Object, _ object.Object) {
+	if _, ok := fn.(*object.Function); !ok {
+		return
+	}
+
+	s := t.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+func (t *tracer) Branch(_ *ast.IfExpression, _ bool) {
+}
+
+func functionName(call *ast.CallExpression) string {
+	if call == nil {
+		return "<anonymous>"
+	}
+
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Value
+	}
+
+	return "<anonymous>"
+}
@@ -0,0 +1,180 @@
+package debugger
+
+import (
+	"bytes"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"strings"
+	"testing"
+)
+
+const testProgram = `let double = fn(x) {
+	let result = x * 2;
+	result
+};
+let a = double(2);
+let b = double(a);
+a + b`
+
+func newTestSession(t *testing.T) *Session {
+	p := parser.NewParser(lexer.NewLexer(testProgram))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return NewSession(program, object.NewEnvironment())
+}
+
+func TestStepping(t *testing.T) {
+	s := newTestSession(t)
+
+	steps := []struct {
+		step         func() Event
+		expectedLine int
+		expectedTop  string
+	}{
+		{func() Event { return s.Start(true) }, 1, "<main>"},
+		{s.StepOver, 5, "<main>"},
+		{s.StepInto, 2, "double"},
+		{s.StepOver, 3, "double"},
+		{s.StepOut, 6, "<main>"},
+		{s.StepOver, 7, "<main>"},
+	}
+
+	for i, tt := range steps {
+		event := tt.step()
+
+		if event.Reason == StopExited {
+			t.Fatalf("steps[%d] - program exited early", i)
+		}
+
+		if event.Line != tt.expectedLine {
+			t.Errorf("steps[%d] - wrong line. expected=%d, got=%d", i, tt.expectedLine, event.Line)
+		}
+
+		if top := s.Stack()[0].Name; top != tt.expectedTop {
+			t.Errorf("steps[%d] - wrong frame. expected=%q, got=%q", i, tt.expectedTop, top)
+		}
+	}
+
+	event := s.StepOver()
+	if event.Reason != StopExited {
+		t.Fatalf("program did not exit. got=%+v", event)
+	}
+
+	if result, ok := event.Result.(*object.Integer); !ok || result.Value != 12 {
+		t.Errorf("wrong result. got=%v", event.Result)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	s := newTestSession(t)
+	s.SetBreakpoint(3)
+
+	event := s.Start(false)
+	if event.Reason != StopBreakpoint || event.Line != 3 {
+		t.Fatalf("expected to stop at the breakpoint. got=%+v", event)
+	}
+
+	stack := s.Stack()
+	if len(stack) != 2 {
+		t.Fatalf("wrong stack depth. got=%d", len(stack))
+	}
+
+	if result := s.Evaluate("result + x", 0); result.Inspect() != "6" {
+		t.Errorf("wrong evaluation in the innermost frame. got=%s", result.Inspect())
+	}
+
+	if result := s.Evaluate("x", 1); result.Inspect() != "ERROR: identifier not found: x" {
+		t.Errorf("wrong evaluation in the outer frame. got=%s", result.Inspect())
+	}
+
+	event = s.Continue()
+	if event.Reason != StopBreakpoint || s.Evaluate("x", 0).Inspect() != "4" {
+		t.Fatalf("expected to stop at the breakpoint again. got=%+v", event)
+	}
+
+	s.ClearBreakpoint(3)
+	if event := s.Continue(); event.Reason != StopExited {
+		t.Fatalf("program did not exit. got=%+v", event)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	s := newTestSession(t)
+	s.Start(true)
+
+	if event := s.Terminate(); event.Reason != StopExited || event.Result != nil {
+		t.Errorf("wrong event after terminating. got=%+v", event)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("crash", &object.Builtin{Fn: func(_ *object.BuiltinContext, _ ...object.Object) object.Object {
+		panic("crashed")
+	}})
+
+	s := NewSession(parser.NewParser(lexer.NewLexer("let a = 1;\ncrash()")).ParseProgram(), env)
+
+	if event := s.Start(false); event.Reason != StopExited || event.Result.Inspect() != "ERROR: internal error: crashed" {
+		t.Errorf("wrong event after a panic. got=%+v", event)
+	}
+	if !s.Exited() {
+		t.Errorf("expected the session to have exited")
+	}
+}
+
+func TestRunTerminal(t *testing.T) {
+	in := strings.NewReader("b 2\nc\nbt\np x + 1\nenv\nq\n")
+	var out bytes.Buffer
+
+	if err := RunTerminal(in, &out, testProgram, 0); err != nil {
+		t.Fatalf("RunTerminal returned an error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"Stopped (entry) at line 1",
+		"Breakpoint set at line 2",
+		"Stopped (breakpoint) at line 2",
+		">#0 double at line 2\n #1 <main> at line 5",
+		PROMPT + "3\n",
+		"environment 0:\n  x = 2\nenvironment 1:\n  double = fn(x)",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output does not contain %q. got=%q", expected, out.String())
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	denied := "ERROR: `now` needs clock access, which is not granted"
+
+	s := NewSession(parser.NewParser(lexer.NewLexer("let t = 0;\nnow() > t")).ParseProgram(), object.NewEnvironment())
+	s.SetBreakpoint(2)
+
+	if event := s.Start(false); event.Reason != StopBreakpoint {
+		t.Fatalf("expected to stop at the breakpoint. got=%+v", event)
+	}
+	if result := s.Evaluate("now()", 0); result.Inspect() != denied {
+		t.Errorf("wrong result of Evaluate with no capabilities. got=%q", result.Inspect())
+	}
+	if event := s.Continue(); event.Result.Inspect() != denied {
+		t.Errorf("wrong result with no capabilities. got=%+v", event)
+	}
+
+	s = NewSession(parser.NewParser(lexer.NewLexer("let t = 0;\nnow() > t")).ParseProgram(), object.NewEnvironment())
+	s.SetCapabilities(object.Clock)
+	s.SetBreakpoint(2)
+
+	if event := s.Start(false); event.Reason != StopBreakpoint {
+		t.Fatalf("expected to stop at the breakpoint. got=%+v", event)
+	}
+	if result := s.Evaluate("now() > t", 0); result.Inspect() != "true" {
+		t.Errorf("wrong result of Evaluate with clock access. got=%q", result.Inspect())
+	}
+	if event := s.Continue(); event.Reason != StopExited || event.Result.Inspect() != "true" {
+		t.Errorf("wrong result with clock access. got=%+v", event)
+	}
+}
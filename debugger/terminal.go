@@ -0,0 +1,258 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(mdb) "
+
+const help = `Commands:
+  break <line>, b <line>     set a breakpoint
+  clear <line>               remove a breakpoint
+  breakpoints                list breakpoints
+  continue, c                run until the next breakpoint
+  next, n                    step over the current line
+  step, s                    step into the current line
+  out, o                     step out of the current function
+  stack, bt                  show the call stack
+  env [frame]                show the environment chain of a frame
+  print <expr>, p <expr>     evaluate an expression in the current frame
+  frame <n>, f <n>           select the frame used by env and print
+  list, l                    show the source around the current line
+  quit, q                    stop debugging
+`
+
+type terminal struct {
+	session *Session
+	lines   []string
+	out     io.Writer
+	frame   int
+}
+
+// RunTerminal debugs source interactively, reading commands from in, with
+// the given capabilities granted to the program.
+func RunTerminal(in io.Reader, out io.Writer, source string, capabilities object.Capability) error {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, d.Error())
+		}
+		return errors.New("parser errors:\n\t" + strings.Join(messages, "\n\t"))
+	}
+
+	t := &terminal{
+		session: NewSession(program, object.NewEnvironment()),
+		lines:   strings.Split(source, "\n"),
+		out:     out,
+	}
+
+	t.session.SetOutput(out)
+	t.session.SetCapabilities(capabilities)
+	t.printf("Type `help` for a list of commands.\n")
+	t.report(t.session.Start(true))
+
+	scanner := bufio.NewScanner(in)
+
+	for {
+		t.printf(PROMPT)
+
+		if !scanner.Scan() {
+			t.session.Terminate()
+			return scanner.Err()
+		}
+
+		if quit := t.execute(strings.Fields(scanner.Text())); quit {
+			t.session.Terminate()
+			return nil
+		}
+	}
+}
+
+func (t *terminal) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(t.out, format, a...)
+}
+
+func (t *terminal) execute(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+
+	command, args := fields[0], fields[1:]
+
+	switch command {
+	case "break", "b":
+		if line, ok := t.numberArgument(args); ok {
+			t.session.SetBreakpoint(line)
+			t.printf("Breakpoint set at line %d\n", line)
+		}
+	case "clear":
+		if line, ok := t.numberArgument(args); ok {
+			t.session.ClearBreakpoint(line)
+			t.printf("Breakpoint cleared at line %d\n", line)
+		}
+	case "breakpoints":
+		for _, line := range t.session.Breakpoints() {
+			t.printf("line %d\n", line)
+		}
+	case "continue", "c":
+		t.resume(t.session.Continue)
+	case "next", "n":
+		t.resume(t.session.StepOver)
+	case "step", "s":
+		t.resume(t.session.StepInto)
+	case "out", "o":
+		t.resume(t.session.StepOut)
+	case "stack", "bt":
+		t.printStack()
+	case "env":
+		frame := t.frame
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				t.printf("invalid frame: %s\n", args[0])
+				return false
+			}
+			frame = n
+		}
+		t.printEnvironment(frame)
+	case "frame", "f":
+		if n, ok := t.numberArgument(args); ok {
+			if n >= len(t.session.Stack()) {
+				t.printf("no such frame: %d\n", n)
+				return false
+			}
+			t.frame = n
+			t.printStack()
+		}
+	case "print", "p":
+		if t.session.Exited() {
+			t.printf("the program is not running\n")
+			return false
+		}
+		result := t.session.Evaluate(strings.Join(args, " "), t.frame)
+		if result != nil {
+			t.printf("%s\n", result.Inspect())
+		}
+	case "list", "l":
+		t.list()
+	case "help", "h":
+		t.printf(help)
+	case "quit", "q":
+		return true
+	default:
+		t.printf("unknown command: %s. Type `help` for a list of commands.\n", command)
+	}
+
+	return false
+}
+
+func (t *terminal) numberArgument(args []string) (int, bool) {
+	if len(args) != 1 {
+		t.printf("expected 1 argument, received %d\n", len(args))
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		t.printf("invalid number: %s\n", args[0])
+		return 0, false
+	}
+
+	return n, true
+}
+
+func (t *terminal) resume(step func() Event) {
+	if t.session.Exited() {
+		t.printf("the program is not running\n")
+		return
+	}
+
+	t.frame = 0
+	t.report(step())
+}
+
+func (t *terminal) report(event Event) {
+	if event.Reason == StopExited {
+		if event.Result != nil {
+			t.printf("Program exited with result: %s\n", event.Result.Inspect())
+		} else {
+			t.printf("Program exited\n")
+		}
+		return
+	}
+
+	t.printf("Stopped (%s) at line %d\n", event.Reason, event.Line)
+	t.printLine(event.Line)
+}
+
+func (t *terminal) printLine(line int) {
+	if line >= 1 && line <= len(t.lines) {
+		t.printf("%4d\t%s\n", line, t.lines[line-1])
+	}
+}
+
+func (t *terminal) list() {
+	stack := t.session.Stack()
+	if t.session.Exited() || len(stack) == 0 {
+		t.printf("the program is not running\n")
+		return
+	}
+
+	current := stack[t.frame].Line
+
+	for line := max(current-3, 1); line <= min(current+3, len(t.lines)); line++ {
+		marker := " "
+		if line == current {
+			marker = ">"
+		}
+		t.printf("%s%4d\t%s\n", marker, line, t.lines[line-1])
+	}
+}
+
+func (t *terminal) printStack() {
+	for i, frame := range t.session.Stack() {
+		marker := " "
+		if i == t.frame {
+			marker = ">"
+		}
+		t.printf("%s#%d %s at line %d\n", marker, i, frame.Name, frame.Line)
+	}
+}
+
+func (t *terminal) printEnvironment(frame int) {
+	stack := t.session.Stack()
+	if frame < 0 || frame >= len(stack) {
+		t.printf("no such frame: %d\n", frame)
+		return
+	}
+
+	depth := 0
+	for env := stack[frame].Environment; env != nil; env = env.Outer() {
+		t.printf("environment %d:\n", depth)
+
+		bindings := env.Bindings()
+		var names []string
+		for name := range bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			t.printf("  %s = %s\n", name, bindings[name].Inspect())
+		}
+
+		depth++
+	}
+}
@@ -0,0 +1,94 @@
+// Package diagnostic describes the problems found in Mandrill source code
+// by the lexer, the parser and the evaluator, in a form that tools can
+// consume without parsing messages.
+package diagnostic
+
+import (
+	"encoding/json"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+)
+
+// Severity uses the values of the Language Server Protocol.
+type Severity int
+
+const (
+	Error Severity = iota + 1
+	Warning
+	Information
+	Hint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Information:
+		return "information"
+	case Hint:
+		return "hint"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Codes identifying the kind of a diagnostic.
+const (
+	IllegalCharacter   = "illegal-character"
+	UnterminatedString = "unterminated-string"
+	MissingToken       = "missing-token"
+	UnexpectedToken    = "unexpected-token"
+	InvalidInteger     = "invalid-integer"
+	RuntimeError       = "runtime-error"
+)
+
+// Range is the part of the source a diagnostic applies to, from Start up
+// to but excluding End.
+type Range struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// TokenRange returns the range of the source covered by tok.
+func TokenRange(tok token.Token) Range {
+	length := len(tok.Literal)
+
+	switch tok.Type {
+	case token.EOF:
+		length = 0
+	case token.STRING:
+		length += 2 // the quotes
+	}
+
+	end := tok.Position
+	end.Offset += length
+	end.Column += length
+
+	return Range{Start: tok.Position, End: end}
+}
+
+// Fix is a suggested change that resolves a diagnostic, replacing Range
+// with NewText.
+type Fix struct {
+	Message string `json:"message"`
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Range    Range    `json:"range"`
+	Fix      *Fix     `json:"fix,omitempty"`
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%d:%d: %s", d.Range.Start.Line, d.Range.Start.Column, d.Message)
+}
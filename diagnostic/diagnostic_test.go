@@ -0,0 +1,99 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"example.com/writing-an-interpreter/token"
+	"testing"
+)
+
+func TestTokenRange(t *testing.T) {
+	tests := []struct {
+		tok    token.Token
+		length int
+	}{
+		{token.Token{Type: token.IDENT, Literal: "foo"}, 3},
+		{token.Token{Type: token.STRING, Literal: "foo"}, 5},
+		{token.Token{Type: token.EOF}, 0},
+	}
+
+	for _, tt := range tests {
+		tt.tok.Position = token.Position{Offset: 4, Line: 2, Column: 3}
+		r := TokenRange(tt.tok)
+
+		if r.Start != tt.tok.Position || r.End.Offset != 4+tt.length || r.End.Column != 3+tt.length || r.End.Line != 2 {
+			t.Errorf("wrong range of %+v. got=%+v", tt.tok, r)
+		}
+	}
+}
+
+func testDiagnostics() []Diagnostic {
+	start := token.Position{Offset: 20, Line: 2, Column: 10}
+	end := token.Position{Offset: 24, Line: 2, Column: 14}
+
+	return []Diagnostic{{
+		Severity: Error,
+		Code:     MissingToken,
+		Message:  "Expected next token to be ), got ; instead",
+		Range:    Range{Start: start, End: end},
+		Fix:      &Fix{Message: "insert `)`", Range: Range{Start: start, End: start}, NewText: ")"},
+	}, {
+		Severity: Warning,
+		Code:     "unused",
+		Message:  "x is unused",
+		Range:    Range{Start: token.Position{Offset: 5, Line: 1, Column: 6}, End: token.Position{Offset: 6, Line: 1, Column: 7}},
+	}}
+}
+
+func TestWriteText(t *testing.T) {
+	source := "\tlet x = 1;\n\tlet y = éé;\n"
+
+	var out bytes.Buffer
+	if err := WriteText(&out, "test.mnd", source, testDiagnostics()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "test.mnd:2:10: error[missing-token]: Expected next token to be ), got ; instead\n" +
+		"    \tlet y = éé;\n" +
+		"    \t        ^^\n" +
+		"    fix: insert `)`\n" +
+		"test.mnd:1:6: warning[unused]: x is unused\n" +
+		"    \tlet x = 1;\n" +
+		"    \t    ^\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong text.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSON(&out, testDiagnostics()); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+
+	if len(decoded) != 2 || decoded[0]["severity"] != "error" || decoded[0]["code"] != "missing-token" {
+		t.Fatalf("wrong JSON. got=%s", out.String())
+	}
+	if fix, ok := decoded[0]["fix"].(map[string]any); !ok || fix["newText"] != ")" {
+		t.Errorf("wrong fix. got=%v", decoded[0]["fix"])
+	}
+	if _, ok := decoded[1]["fix"]; ok {
+		t.Errorf("expected no fix. got=%v", decoded[1]["fix"])
+	}
+	start := decoded[0]["range"].(map[string]any)["start"].(map[string]any)
+	if start["line"] != 2.0 || start["column"] != 10.0 {
+		t.Errorf("wrong start position. got=%v", start)
+	}
+
+	out.Reset()
+	_ = WriteJSON(&out, nil)
+	if out.String() != "[]\n" {
+		t.Errorf("expected an empty array. got=%q", out.String())
+	}
+}
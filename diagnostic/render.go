@@ -0,0 +1,85 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// WriteText writes each diagnostic with the line of source it applies to
+// and a caret under the offending columns, e.g.
+//
+//	script.mnd:1:7: error[missing-token]: Expected next token to be =, got INT instead
+//	    let x 5;
+//	          ^
+//
+// The filename is omitted when empty.
+func WriteText(w io.Writer, filename string, source string, diagnostics []Diagnostic) error {
+	lines := strings.Split(source, "\n")
+
+	for _, d := range diagnostics {
+		start := d.Range.Start
+		location := fmt.Sprintf("%d:%d", start.Line, start.Column)
+		if filename != "" {
+			location = filename + ":" + location
+		}
+
+		_, err := fmt.Fprintf(w, "%s: %s[%s]: %s\n", location, d.Severity, d.Code, d.Message)
+		if err != nil {
+			return err
+		}
+
+		if start.Line < 1 || start.Line > len(lines) {
+			continue
+		}
+
+		line := strings.TrimRight(lines[start.Line-1], "\r")
+		column := min(max(start.Column-1, 0), len(line))
+		width := 1
+		if d.Range.End.Line == start.Line && d.Range.End.Column > start.Column {
+			width = utf8.RuneCountInString(line[column:min(d.Range.End.Column-1, len(line))])
+		}
+
+		_, err = fmt.Fprintf(w, "    %s\n    %s%s\n", line, indentation(line[:column]), strings.Repeat("^", max(width, 1)))
+		if err != nil {
+			return err
+		}
+
+		if d.Fix != nil {
+			if _, err := fmt.Fprintf(w, "    fix: %s\n", d.Fix.Message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// indentation returns the whitespace aligning text under the characters of
+// prefix, keeping its tabs.
+func indentation(prefix string) string {
+	var b strings.Builder
+
+	for _, r := range prefix {
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	return b.String()
+}
+
+// WriteJSON writes the diagnostics as a JSON array.
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
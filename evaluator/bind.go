@@ -0,0 +1,399 @@
+package evaluator
+
+import (
+	"context"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// Bind converts a Go value to a Mandrill object. Booleans, numbers, strings,
+// slices, arrays and maps are converted to the corresponding objects, errors
+// to object.Error, structs and pointers to structs to object.Struct, and
+// functions to object.Builtin, which convert their arguments and results
+// in the same way. A Go function may take a context.Context as its first
+// parameter, receiving the one of the evaluation, and return an error as
+// its last result, which is returned as an object.Error when not nil.
+// Slices, maps and pointers that contain themselves cannot be bound.
+func Bind(v any) (object.Object, error) {
+	return toObject(reflect.ValueOf(v), make(map[reference]bool))
+}
+
+// RegisterFunc binds fn, which must be a Go function, and registers it in
+// the module under the given name.
+func (m *Module) RegisterFunc(name string, fn any) error {
+	v := reflect.ValueOf(fn)
+
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("cannot register %T as a function", fn)
+	}
+
+	m.Register(name, bindFunc(v))
+	return nil
+}
+
+// reference identifies the slice, map or pointer a Go value refers to.
+type reference struct {
+	t      reflect.Type
+	ptr    uintptr
+	length int
+}
+
+// toObject converts v to an object, keeping track of the slices, maps and
+// pointers being converted to detect cycles.
+func toObject(v reflect.Value, visiting map[reference]bool) (object.Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if !v.CanInterface() {
+		return nil, fmt.Errorf("cannot bind an unexported value of type %s", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+	}
+
+	if obj, ok := v.Interface().(object.Object); ok {
+		return obj, nil
+	}
+
+	if err, ok := v.Interface().(error); ok {
+		return newError("%s", err), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer:
+		ref := reference{t: v.Type(), ptr: v.Pointer()}
+		if v.Kind() == reflect.Slice {
+			ref.length = v.Len()
+		}
+		if visiting[ref] {
+			return nil, fmt.Errorf("cannot bind a cyclic value of type %s", v.Type())
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		return toObject(v.Elem(), visiting)
+	case reflect.Bool:
+		return newBooleanObject(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return newIntegerObject(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return newIntegerObject(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return newFloatObject(v.Float()), nil
+	case reflect.String:
+		return newStringObject(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			return newStringObject(string(v.Bytes())), nil
+		}
+
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			e, err := toObject(v.Index(i), visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = e
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		m := &object.Map{Pairs: make(map[object.HashKey]object.MapPair)}
+		iter := v.MapRange()
+
+		for iter.Next() {
+			key, err := toObject(iter.Key(), visiting)
+			if err != nil {
+				return nil, err
+			}
+
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("invalid map key type: %s", key.Type())
+			}
+
+			value, err := toObject(iter.Value(), visiting)
+			if err != nil {
+				return nil, err
+			}
+
+			m.Pairs[hashable.HashKey()] = object.MapPair{Key: key, Value: value}
+		}
+
+		return m, nil
+	case reflect.Func:
+		return bindFunc(v), nil
+	case reflect.Pointer:
+		if v.Elem().Kind() == reflect.Struct {
+			return &object.Struct{Value: v}, nil
+		}
+		return toObject(v.Elem(), visiting)
+	case reflect.Struct:
+		// Copy the struct so that methods with pointer receivers can be
+		// called on it.
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return &object.Struct{Value: p}, nil
+	default:
+		return nil, fmt.Errorf("cannot bind a value of type %s", v.Type())
+	}
+}
+
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() != reflect.Interface || t.NumMethod() > 0 {
+		if reflect.TypeOf(obj).AssignableTo(t) {
+			return reflect.ValueOf(obj), nil
+		}
+	}
+
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	}
+
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if s, ok := obj.(*object.Struct); ok && s.Value.Type().AssignableTo(t) {
+			return s.Value, nil
+		}
+		if t.NumMethod() > 0 {
+			return fail()
+		}
+		if value := toGo(obj); value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return fail()
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return fail()
+		}
+		if v.OverflowInt(i.Value) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return fail()
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.Float32, reflect.Float64:
+		if !isNumber(obj) {
+			return fail()
+		}
+		v.SetFloat(toFloat(obj))
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return fail()
+		}
+		v.SetString(s.Value)
+	case reflect.Slice:
+		if s, ok := obj.(*object.String); ok && t.Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s.Value))
+			break
+		}
+
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return fail()
+		}
+
+		v.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+		for i, e := range array.Elements {
+			element, err := fromObject(e, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(element)
+		}
+	case reflect.Map:
+		m, ok := obj.(*object.Map)
+		if !ok {
+			return fail()
+		}
+
+		v.Set(reflect.MakeMapWithSize(t, len(m.Pairs)))
+		for _, pair := range m.Pairs {
+			key, err := fromObject(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := fromObject(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Pointer, reflect.Struct:
+		s, ok := obj.(*object.Struct)
+		switch {
+		case ok && s.Value.Type() == t:
+			return s.Value, nil
+		case ok && s.Value.Elem().Type() == t:
+			return s.Value.Elem(), nil
+		default:
+			return fail()
+		}
+	default:
+		return fail()
+	}
+
+	return v, nil
+}
+
+// toGo converts obj to the Go value it naturally corresponds to, for
+// parameters of type any.
+func toGo(obj object.Object) any {
+	switch o := obj.(type) {
+	case *object.Null:
+		return nil
+	case *object.Boolean:
+		return o.Value
+	case *object.Integer:
+		return o.Value
+	case *object.Float:
+		return o.Value
+	case *object.String:
+		return o.Value
+	case *object.Array:
+		elements := make([]any, len(o.Elements))
+		for i, e := range o.Elements {
+			elements[i] = toGo(e)
+		}
+		return elements
+	case *object.Map:
+		m := make(map[any]any, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			m[toGo(pair.Key)] = toGo(pair.Value)
+		}
+		return m
+	case *object.Struct:
+		return o.Value.Interface()
+	default:
+		return obj
+	}
+}
+
+func bindFunc(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+
+	return &object.Builtin{Fn: func(ctx *object.BuiltinContext, args ...object.Object) (result object.Object) {
+		var in []reflect.Value
+		params := t.NumIn()
+		first := 0
+
+		if params > 0 && t.In(0) == contextType {
+			c := ctx.Context
+			if c == nil {
+				c = context.Background()
+			}
+			in = append(in, reflect.ValueOf(c))
+			first = 1
+		}
+
+		fixed := params - first
+		if t.IsVariadic() {
+			fixed--
+		}
+
+		if len(args) < fixed || (!t.IsVariadic() && len(args) > fixed) {
+			return newArgumentNumberError(fixed, len(args), t.IsVariadic())
+		}
+
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i >= fixed {
+				paramType = t.In(params - 1).Elem()
+			} else {
+				paramType = t.In(first + i)
+			}
+
+			value, err := fromObject(arg, paramType)
+			if err != nil {
+				return newError("argument %d: %s", i+1, err)
+			}
+			in = append(in, value)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("Go function panicked: %v", r)
+			}
+		}()
+
+		out := fn.Call(in)
+
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err := out[n-1]; !err.IsNil() {
+				return newError("%s", err.Interface().(error))
+			}
+			out = out[:n-1]
+		}
+
+		results := make([]object.Object, len(out))
+		for i, v := range out {
+			obj, err := toObject(v, make(map[reference]bool))
+			if err != nil {
+				return newError("%s", err)
+			}
+			results[i] = obj
+		}
+
+		switch len(results) {
+		case 0:
+			return NULL
+		case 1:
+			return allocated(ctx, results[0])
+		default:
+			return allocated(ctx, &object.Array{Elements: results})
+		}
+	}}
+}
+
+func evalStructIndexExpression(s *object.Struct, name string) object.Object {
+	if method := s.Value.MethodByName(name); method.IsValid() {
+		return bindFunc(method)
+	}
+
+	if field, ok := s.Value.Elem().Type().FieldByName(name); ok && field.IsExported() {
+		v, err := s.Value.Elem().FieldByIndexErr(field.Index)
+		if err != nil {
+			return newError("cannot read %s: %s", name, err)
+		}
+		value, err := toObject(v, make(map[reference]bool))
+		if err != nil {
+			return newError("%s", err)
+		}
+		return value
+	}
+
+	return newError("%s has no field or method %s", s.Value.Elem().Type(), name)
+}
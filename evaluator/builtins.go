@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"example.com/writing-an-interpreter/object"
@@ -13,35 +14,30 @@ import (
 	"unicode/utf8"
 )
 
-var builtins = map[string]*object.Builtin{
-	"print":  {Fn: builtinPrint},
-	"len":    {Fn: builtinLen},
-	"append": {Fn: builtinAppend},
-	"first":  {Fn: builtinFirst},
-	"last":   {Fn: builtinLast},
-	"skip":   {Fn: builtinSkip},
-	"quote":  {Fn: builtinQuote},
-}
-
-func builtinPrint(args ...object.Object) object.Object {
+func builtinPrint(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	var arguments []string
 
 	for _, a := range args {
 		arguments = append(arguments, a.Inspect())
 	}
 
-	fmt.Println(strings.Join(arguments, " "))
+	if _, err := fmt.Fprintln(ctx.Out, strings.Join(arguments, " ")); err != nil {
+		return newError("could not print: %s", err)
+	}
 	return NULL
 }
 
-func builtinLen(args ...object.Object) object.Object {
+func builtinLen(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newArgumentNumberError(1, len(args), false)
 	}
 
 	switch arg := args[0].(type) {
 	case *object.String:
-		return newIntegerObject(stringLength(arg.Value))
+		if err := arg.Index(ctx.Allocator); err != nil {
+			return err
+		}
+		return newIntegerObject(int64(arg.Len()))
 	case *object.Array:
 		return newIntegerObject(int64(len(arg.Elements)))
 	case *object.Map:
@@ -51,11 +47,7 @@ func builtinLen(args ...object.Object) object.Object {
 	}
 }
 
-func stringLength(s string) int64 {
-	return int64(utf8.RuneCountInString(s))
-}
-
-func builtinFirst(args ...object.Object) object.Object {
+func builtinFirst(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newArgumentNumberError(1, len(args), false)
 	}
@@ -70,7 +62,7 @@ func builtinFirst(args ...object.Object) object.Object {
 		if arg.Value == "" {
 			return NULL
 		}
-		return newStringObject(stringFirst(arg.Value))
+		return allocated(ctx, newStringObject(stringFirst(arg.Value)))
 	default:
 		return newInvalidArgumentError("first", arg)
 	}
@@ -81,7 +73,7 @@ func stringFirst(s string) string {
 	return s[:size]
 }
 
-func builtinLast(args ...object.Object) object.Object {
+func builtinLast(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newArgumentNumberError(1, len(args), false)
 	}
@@ -96,7 +88,7 @@ func builtinLast(args ...object.Object) object.Object {
 		if arg.Value == "" {
 			return NULL
 		}
-		return newStringObject(stringLast(arg.Value))
+		return allocated(ctx, newStringObject(stringLast(arg.Value)))
 	default:
 		return newInvalidArgumentError("last", arg)
 	}
@@ -107,7 +99,7 @@ func stringLast(value string) string {
 	return value[len(value)-size:]
 }
 
-func builtinSkip(args ...object.Object) object.Object {
+func builtinSkip(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	if len(args) != 2 {
 		return newArgumentNumberError(2, len(args), false)
 	}
@@ -121,33 +113,39 @@ func builtinSkip(args ...object.Object) object.Object {
 	switch arg := args[0].(type) {
 	case *object.Array:
 		length := int64(len(arg.Elements))
-		if s > length {
-			return &object.Array{}
-		}
+		// Skipping a negative number of elements skips none, as for strings.
+		s = min(max(s, 0), length)
 		newElements := make([]object.Object, length-s)
 		copy(newElements, arg.Elements[s:])
-		return &object.Array{Elements: newElements}
+		return allocatedContainer(ctx, &object.Array{Elements: newElements})
 	case *object.String:
-		return newStringObject(stringSkip(arg.Value, s))
+		if err := arg.Index(ctx.Allocator); err != nil {
+			return err
+		}
+		return allocated(ctx, newStringObject(stringSkip(arg, s)))
 	default:
-		return newInvalidArgumentError("first", arg)
+		return newInvalidArgumentError("skip", arg)
 	}
 }
 
-func stringSkip(str string, skip int64) string {
-	if skip >= stringLength(str) {
+func stringSkip(str *object.String, skip int64) string {
+	length := int64(str.Len())
+	switch {
+	case skip >= length:
 		return ""
+	case skip < 0:
+		return str.Value
 	}
-	for ; skip > 0; skip-- {
-		_, size := utf8.DecodeRuneInString(str)
-		str = str[size:]
-	}
-	return str
+	return str.Substring(int(skip), int(length))
 }
 
-func builtinQuote(_ ...object.Object) object.Object {
+func builtinQuote(ctx *object.BuiltinContext, _ ...object.Object) object.Object {
+	if err := ctx.Require("quote", object.Network|object.EnvironmentVariables); err != nil {
+		return err
+	}
+
 	result := &object.String{}
-	q, err := getRandomQuote()
+	q, err := getRandomQuote(ctx.Context)
 
 	if err != nil {
 		result.Value = quote.Opt()
@@ -155,11 +153,17 @@ func builtinQuote(_ ...object.Object) object.Object {
 		result.Value = q
 	}
 
-	return result
+	return allocated(ctx, result)
 }
 
-func getRandomQuote() (string, error) {
-	response, err := http.Get(os.Getenv("RANDOM_QUOTE_ENDPOINT"))
+func getRandomQuote(ctx context.Context) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, os.Getenv("RANDOM_QUOTE_ENDPOINT"), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	response, err := http.DefaultClient.Do(request)
 
 	if err != nil {
 		return "", err
@@ -188,14 +192,22 @@ type Quotes []struct {
 	Html   string `json:"h"`
 }
 
-func builtinAppend(args ...object.Object) object.Object {
+func builtinAppend(ctx *object.BuiltinContext, args ...object.Object) object.Object {
 	if len(args) < 2 {
 		return newArgumentNumberError(2, len(args), true)
 	}
 
 	switch arg := args[0].(type) {
 	case *object.Array:
-		return &object.Array{Elements: append(arg.Elements, args[1:]...)}
+		if err := ctx.Reserve(arraySize(len(arg.Elements) + len(args) - 1)); err != nil {
+			return err
+		}
+		// Copy into a new slice: appending to arg.Elements could write into
+		// spare capacity that another array shares.
+		elements := make([]object.Object, 0, len(arg.Elements)+len(args)-1)
+		elements = append(elements, arg.Elements...)
+		elements = append(elements, args[1:]...)
+		return allocatedContainer(ctx, &object.Array{Elements: elements})
 	default:
 		return newInvalidArgumentError("append", arg)
 	}
@@ -0,0 +1,412 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"math"
+	"sort"
+)
+
+// arrayAndFunction checks the arguments of the builtins taking an array and
+// a callback.
+func arrayAndFunction(name string, args []object.Object) (*object.Array, object.Object, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newArgumentNumberError(2, len(args), false)
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newInvalidArgumentError(name, args[0])
+	}
+
+	if !isCallable(args[1]) {
+		return nil, nil, newInvalidArgumentError(name, args[1])
+	}
+
+	return array, args[1], nil
+}
+
+func isCallable(obj object.Object) bool {
+	return obj.Type() == object.FUNCTION || obj.Type() == object.BUILTIN
+}
+
+func builtinMap(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	array, fn, err := arrayAndFunction("map", args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, len(array.Elements))
+
+	for i, e := range array.Elements {
+		result := ctx.Apply(fn, e)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: elements})
+}
+
+func builtinFilter(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	array, fn, err := arrayAndFunction("filter", args)
+	if err != nil {
+		return err
+	}
+
+	var elements []object.Object
+
+	for _, e := range array.Elements {
+		result := ctx.Apply(fn, e)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, e)
+		}
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: elements})
+}
+
+func builtinReduce(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("expected 2 or 3 arguments, received %d", len(args))
+	}
+
+	array, fn, err := arrayAndFunction("reduce", args[:2])
+	if err != nil {
+		return err
+	}
+
+	elements := array.Elements
+	var accumulator object.Object
+
+	if len(args) == 3 {
+		accumulator = args[2]
+	} else if len(elements) == 0 {
+		return newError("reduce of an empty array with no initial value")
+	} else {
+		accumulator, elements = elements[0], elements[1:]
+	}
+
+	for _, e := range elements {
+		accumulator = ctx.Apply(fn, accumulator, e)
+		if isError(accumulator) {
+			return accumulator
+		}
+	}
+
+	return accumulator
+}
+
+// builtinSort returns a sorted copy of an array of integers, floats or
+// strings, or of any array given a comparator returning a negative integer,
+// zero or a positive integer when its first argument is less than, equal to
+// or greater than its second one.
+func builtinSort(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("expected 1 or 2 arguments, received %d", len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newInvalidArgumentError("sort", args[0])
+	}
+
+	compare := compareObjects
+	if len(args) == 2 {
+		if !isCallable(args[1]) {
+			return newInvalidArgumentError("sort", args[1])
+		}
+		compare = func(a object.Object, b object.Object) (int64, object.Object) {
+			result := ctx.Apply(args[1], a, b)
+			if isError(result) {
+				return 0, result
+			}
+			i, ok := result.(*object.Integer)
+			if !ok {
+				return 0, newError("sort comparator must return an INTEGER, got %s", result.Type())
+			}
+			return i.Value, nil
+		}
+	}
+
+	elements := make([]object.Object, len(array.Elements))
+	copy(elements, array.Elements)
+	var sortErr object.Object
+
+	sort.SliceStable(elements, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		c, err := compare(elements[i], elements[j])
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return c < 0
+	})
+
+	if sortErr != nil {
+		return sortErr
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: elements})
+}
+
+func compareObjects(a object.Object, b object.Object) (int64, object.Object) {
+	switch {
+	case a.Type() == object.INTEGER && b.Type() == object.INTEGER:
+		return compareOrdered(a.(*object.Integer).Value, b.(*object.Integer).Value), nil
+	case isNumber(a) && isNumber(b):
+		return compareOrdered(toFloat(a), toFloat(b)), nil
+	case a.Type() == object.STRING && b.Type() == object.STRING:
+		return compareOrdered(a.(*object.String).Value, b.(*object.String).Value), nil
+	default:
+		return 0, newError("could not compare %s and %s, pass a comparator to sort", a.Type(), b.Type())
+	}
+}
+
+func compareOrdered[T int64 | float64 | string](a T, b T) int64 {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// predicate applies the optional predicate of any, all and find, or tells
+// whether the element itself is truthy if there is none.
+func predicate(ctx *object.BuiltinContext, fn object.Object, e object.Object) (bool, object.Object) {
+	if fn == nil {
+		return isTruthy(e), nil
+	}
+
+	result := ctx.Apply(fn, e)
+	if isError(result) {
+		return false, result
+	}
+
+	return isTruthy(result), nil
+}
+
+func arrayAndPredicate(name string, args []object.Object) (*object.Array, object.Object, *object.Error) {
+	if len(args) == 1 {
+		array, ok := args[0].(*object.Array)
+		if !ok {
+			return nil, nil, newInvalidArgumentError(name, args[0])
+		}
+		return array, nil, nil
+	}
+
+	if len(args) != 2 {
+		return nil, nil, newError("expected 1 or 2 arguments, received %d", len(args))
+	}
+
+	return arrayAndFunction(name, args)
+}
+
+func builtinAny(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	array, fn, err := arrayAndPredicate("any", args)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range array.Elements {
+		ok, err := predicate(ctx, fn, e)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return TRUE
+		}
+	}
+
+	return FALSE
+}
+
+func builtinAll(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	array, fn, err := arrayAndPredicate("all", args)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range array.Elements {
+		ok, err := predicate(ctx, fn, e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return FALSE
+		}
+	}
+
+	return TRUE
+}
+
+func builtinFind(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	array, fn, err := arrayAndPredicate("find", args)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range array.Elements {
+		ok, err := predicate(ctx, fn, e)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return e
+		}
+	}
+
+	return NULL
+}
+
+func builtinZip(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return newArgumentNumberError(2, len(args), true)
+	}
+
+	var arrays []*object.Array
+	length := -1
+
+	for _, arg := range args {
+		array, ok := arg.(*object.Array)
+		if !ok {
+			return newInvalidArgumentError("zip", arg)
+		}
+		arrays = append(arrays, array)
+
+		if length == -1 || len(array.Elements) < length {
+			length = len(array.Elements)
+		}
+	}
+
+	tuples := make([]object.Object, length)
+
+	for i := range tuples {
+		tuple := make([]object.Object, len(arrays))
+		for j, array := range arrays {
+			tuple[j] = array.Elements[i]
+		}
+		tuples[i] = &object.Array{Elements: tuple}
+	}
+
+	if err := ctx.Allocate(arraySize(len(arrays)) * int64(length)); err != nil {
+		return err
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: tuples})
+}
+
+// builtinRange returns the integers from start, 0 by default, up to but not
+// including end, counting by step, 1 by default.
+func builtinRange(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("expected 1 to 3 arguments, received %d", len(args))
+	}
+
+	bounds := []int64{0, 0, 1}
+
+	for i, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newInvalidArgumentError("range", arg)
+		}
+		bounds[i] = integer.Value
+	}
+
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+
+	if step == 0 {
+		return newError("range step cannot be 0")
+	}
+
+	n := rangeLength(start, end, step)
+
+	size := int64(math.MaxInt64)
+	if n < (math.MaxInt64-sliceHeaderSize)/interfaceSize {
+		size = arraySize(int(n))
+	}
+	if err := ctx.Reserve(size); err != nil {
+		return err
+	}
+
+	var elements []object.Object
+
+	for k := uint64(0); k < n; k++ {
+		// Without a memory limit, a range may take too long to ever be
+		// built, so it stops once the evaluation is cancelled.
+		if k%cancellationInterval == 0 {
+			if err := contextCancelled(ctx); err != nil {
+				return err
+			}
+		}
+		elements = append(elements, newIntegerObject(start+int64(k)*step))
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: elements})
+}
+
+// cancellationInterval is how many elements built-in functions building
+// long arrays create between checks for cancellation.
+const cancellationInterval = 1 << 16
+
+// contextCancelled returns an error once the context of the evaluation
+// calling a built-in function is done.
+func contextCancelled(ctx *object.BuiltinContext) *object.Error {
+	if ctx.Context == nil {
+		return nil
+	}
+	if err := ctx.Context.Err(); err != nil {
+		return newError("evaluation cancelled: %s", err)
+	}
+	return nil
+}
+
+// rangeLength returns the number of integers from start to end, excluded,
+// by step, which is not 0.
+func rangeLength(start, end, step int64) uint64 {
+	// The distances are computed on unsigned integers, which they always
+	// fit in.
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/(-uint64(step)) + 1
+	default:
+		return 0
+	}
+}
+
+func builtinEnumerate(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newArgumentNumberError(1, len(args), false)
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newInvalidArgumentError("enumerate", args[0])
+	}
+
+	pairs := make([]object.Object, len(array.Elements))
+
+	for i, e := range array.Elements {
+		pairs[i] = &object.Array{Elements: []object.Object{newIntegerObject(int64(i)), e}}
+	}
+
+	if err := ctx.Allocate(arraySize(2) * int64(len(pairs))); err != nil {
+		return err
+	}
+
+	return allocatedContainer(ctx, &object.Array{Elements: pairs})
+}
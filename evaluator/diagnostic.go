@@ -0,0 +1,17 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/diagnostic"
+	"example.com/writing-an-interpreter/object"
+)
+
+// ErrorDiagnostic describes an error returned by the evaluation of a
+// program, located at the node whose evaluation failed.
+func ErrorDiagnostic(err *object.Error) diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.RuntimeError,
+		Message:  err.Message,
+		Range:    diagnostic.Range{Start: err.Position, End: err.Position},
+	}
+}
@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"context"
 	"example.com/writing-an-interpreter/ast"
 	"example.com/writing-an-interpreter/object"
 	"fmt"
+	"io"
+	"os"
 )
 
 var (
@@ -12,23 +15,108 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// maxCallDepth bounds the nested calls of functions, so that an unbounded
+// recursion ends with an error rather than overflowing the Go stack.
+const maxCallDepth = 10000
+
+// Tracer observes an evaluation, e.g. to debug or profile it.
+type Tracer interface {
+	// Statement is called before each statement of a program or block is evaluated.
+	Statement(statement ast.Statement, env *object.Environment)
+	// Call is called before a function is applied. env is the environment
+	// of the function body, or nil for built-in functions.
+	Call(call *ast.CallExpression, fn object.Object, env *object.Environment)
+	// Return is called once a function applied by Call returns.
+	Return(call *ast.CallExpression, fn object.Object, result object.Object)
+	// Branch is called once the condition of an if expression is evaluated,
+	// reporting whether its consequence is taken.
+	Branch(ie *ast.IfExpression, consequence bool)
+}
+
+type multiTracer []Tracer
+
+// MultiTracer returns a Tracer that forwards every event to each of tracers.
+func MultiTracer(tracers ...Tracer) Tracer {
+	return multiTracer(tracers)
+}
+
+func (m multiTracer) Statement(statement ast.Statement, env *object.Environment) {
+	for _, t := range m {
+		t.Statement(statement, env)
+	}
+}
+
+func (m multiTracer) Call(call *ast.CallExpression, fn object.Object, env *object.Environment) {
+	for _, t := range m {
+		t.Call(call, fn, env)
+	}
+}
+
+func (m multiTracer) Return(call *ast.CallExpression, fn object.Object, result object.Object) {
+	for _, t := range m {
+		t.Return(call, fn, result)
+	}
+}
+
+func (m multiTracer) Branch(ie *ast.IfExpression, consequence bool) {
+	for _, t := range m {
+		t.Branch(ie, consequence)
+	}
+}
+
+type Interpreter struct {
+	Tracer Tracer
+	// Out is where built-in functions such as print write.
+	Out io.Writer
+	// Context stops the evaluation with an error once it is cancelled.
+	Context context.Context
+	// Capabilities are the kinds of access to the outside world granted to
+	// built-in functions, none by default.
+	Capabilities object.Capability
+	// MemoryLimit is the number of bytes that the strings, arrays and maps
+	// created by the evaluated programs may take in total, or 0 for no limit.
+	MemoryLimit int64
+	allocated   int64
+	depth       int // the number of function calls being evaluated
+	modules     []*Module
+}
+
+// NewInterpreter returns an interpreter with every standard module enabled.
+func NewInterpreter() *Interpreter {
+	return &Interpreter{Out: os.Stdout, Context: context.Background(), modules: standardModules()}
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return NewInterpreter().Eval(node, env)
+}
+
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	result := in.eval(node, env)
+
+	if err, ok := result.(*object.Error); ok && err.Position.Line == 0 && node != nil {
+		err.Position = node.Position()
+	}
+
+	return result
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
 	switch n := node.(type) {
 	case *ast.Program:
-		return evalProgram(n.Statements, env)
+		return in.evalProgram(n.Statements, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(n.Statements, env)
+		return in.evalBlockStatement(n.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(n.Expression, env)
+		return in.Eval(n.Expression, env)
 	case *ast.LetStatement:
-		value := Eval(n.Value, env)
+		value := in.Eval(n.Value, env)
 		if isError(value) {
 			return value
 		}
 		env.Set(n.Name.Value, value)
 		return nil
 	case *ast.Identifier:
-		return evalIdentifier(n.Value, env)
+		return in.evalIdentifier(n.Value, env)
 	case *ast.FunctionLiteral:
 		return &object.Function{
 			Parameters:  n.Parameters,
@@ -36,45 +124,58 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			Environment: env,
 		}
 	case *ast.CallExpression:
-		function := Eval(n.Function, env)
+		function := in.Eval(n.Function, env)
 		if isError(function) {
 			return function
 		}
-		arguments := evalExpressions(n.Arguments, env)
+		arguments := in.evalExpressions(n.Arguments, env)
 		if len(arguments) == 1 && isError(arguments[0]) {
 			return arguments[0]
 		}
-		return evalCallExpression(function, arguments)
+		return in.applyFunction(n, function, arguments, env)
 	case *ast.ReturnStatement:
-		value := Eval(n.ReturnValue, env)
+		value := in.Eval(n.ReturnValue, env)
 		if isError(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
 	case *ast.IfExpression:
-		return evalIfExpression(n, env)
+		return in.evalIfExpression(n, env)
 	case *ast.InfixExpression:
-		left := Eval(n.Left, env)
+		left := in.Eval(n.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(n.Right, env)
+		right := in.Eval(n.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(n.Operator, left, right)
+		if l, r, ok := stringOperands(left, right); ok && n.Operator == "+" {
+			if err := in.Reserve(stringSize(len(l.Value) + len(r.Value))); err != nil {
+				return err
+			}
+		}
+		return in.allocate(evalInfixExpression(n.Operator, left, right))
 	case *ast.IndexExpression:
-		left := Eval(n.Left, env)
+		left := in.Eval(n.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(n.Index, env)
+		index := in.Eval(n.Index, env)
 		if isError(index) {
 			return index
 		}
+		if s, ok := left.(*object.String); ok {
+			if err := s.Index(in); err != nil {
+				return err
+			}
+			return in.allocate(evalIndexExpression(s, index))
+		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return in.evalSliceExpression(n, env)
 	case *ast.PrefixExpression:
-		right := Eval(n.Right, env)
+		right := in.Eval(n.Right, env)
 		if isError(right) {
 			return right
 		}
@@ -86,25 +187,52 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.Null:
 		return NULL
 	case *ast.StringLiteral:
-		return newStringObject(n.Value)
+		return in.allocate(newStringObject(n.Value))
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(n.Elements, env)
+		elements := in.evalExpressions(n.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return in.allocateContainer(&object.Array{Elements: elements})
 	case *ast.MapLiteral:
-		return evalMapLiteral(n, env)
+		return in.evalMapLiteral(n, env)
 	default:
 		return nil
 	}
 }
 
-func evalMapLiteral(ml *ast.MapLiteral, env *object.Environment) object.Object {
+func (in *Interpreter) evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	left := in.Eval(se.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := make([]object.Object, 3)
+
+	for i, b := range []ast.Expression{se.Start, se.End, se.Step} {
+		if b == nil {
+			continue
+		}
+		bounds[i] = in.Eval(b, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	if s, ok := left.(*object.String); ok {
+		if err := s.Index(in); err != nil {
+			return err
+		}
+	}
+
+	return in.allocateContainer(evalSliceExpression(left, bounds[0], bounds[1], bounds[2]))
+}
+
+func (in *Interpreter) evalMapLiteral(ml *ast.MapLiteral, env *object.Environment) object.Object {
 	m := &object.Map{Pairs: make(map[object.HashKey]object.MapPair)}
 
 	for keyExp, valExp := range ml.Pairs {
-		k := Eval(keyExp, env)
+		k := in.Eval(keyExp, env)
 
 		if isError(k) {
 			return k
@@ -116,7 +244,7 @@ func evalMapLiteral(ml *ast.MapLiteral, env *object.Environment) object.Object {
 			return newError("invalid map key type: %s", k.Type())
 		}
 
-		v := Eval(valExp, env)
+		v := in.Eval(valExp, env)
 
 		if isError(v) {
 			return v
@@ -125,14 +253,19 @@ func evalMapLiteral(ml *ast.MapLiteral, env *object.Environment) object.Object {
 		m.Pairs[hashable.HashKey()] = object.MapPair{Key: k, Value: v}
 	}
 
-	return m
+	return in.allocateContainer(m)
 }
 
-func evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range statements {
-		result = Eval(statement, env)
+		if err := in.cancelled(); err != nil {
+			return err
+		}
+
+		in.traceStatement(statement, env)
+		result = in.Eval(statement, env)
 
 		switch r := result.(type) {
 		case *object.ReturnValue:
@@ -145,11 +278,16 @@ func evalProgram(statements []ast.Statement, env *object.Environment) object.Obj
 	return result
 }
 
-func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range statements {
-		result = Eval(statement, env)
+		if err := in.cancelled(); err != nil {
+			return err
+		}
+
+		in.traceStatement(statement, env)
+		result = in.Eval(statement, env)
 
 		if result == nil {
 			continue
@@ -164,11 +302,11 @@ func evalBlockStatement(statements []ast.Statement, env *object.Environment) obj
 	return result
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (in *Interpreter) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var results []object.Object
 
 	for _, exp := range expressions {
-		evaluated := Eval(exp, env)
+		evaluated := in.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -178,21 +316,98 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return results
 }
 
-func evalCallExpression(f object.Object, args []object.Object) object.Object {
+// Apply calls fn, a user-defined or built-in function, with args, as if it
+// were called from Mandrill code.
+func (in *Interpreter) Apply(fn object.Object, args ...object.Object) object.Object {
+	return in.applyFunction(nil, fn, args, nil)
+}
+
+// applyFunction applies f to args. call and env are those of the call site,
+// or nil when the function is applied from Go.
+func (in *Interpreter) applyFunction(call *ast.CallExpression, f object.Object, args []object.Object, env *object.Environment) object.Object {
+	var result object.Object
+
 	switch fn := f.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newArgumentNumberError(len(fn.Parameters), len(args), false)
+		}
+
+		if in.depth == maxCallDepth {
+			return newError("maximum call depth of %d exceeded", maxCallDepth)
+		}
+		in.depth++
+		defer func() { in.depth-- }()
+
 		extendedEnv := object.NewEnclosedEnvironment(fn.Environment)
 
 		for i, param := range fn.Parameters {
 			extendedEnv.Set(param.Value, args[i])
 		}
 
-		return unwrapReturnValue(Eval(fn.Body, extendedEnv))
+		in.traceCall(call, fn, extendedEnv)
+		result = unwrapReturnValue(in.Eval(fn.Body, extendedEnv))
 	case *object.Builtin:
-		return fn.Fn(args...)
+		in.traceCall(call, fn, nil)
+		// Built-in functions account for the values they create, so that
+		// returning an existing value, e.g. an element of an array, is free.
+		result = fn.Fn(in.builtinContext(call, env), args...)
 	default:
 		return newError("not a function: %s", f.Type())
 	}
+
+	in.traceReturn(call, f, result)
+	return result
+}
+
+func (in *Interpreter) builtinContext(call *ast.CallExpression, env *object.Environment) *object.BuiltinContext {
+	ctx := &object.BuiltinContext{
+		Context:     in.Context,
+		Out:         in.Out,
+		Environment: env,
+		Apply:       in.Apply,
+		Allocator:   in,
+
+		Capabilities: in.Capabilities,
+	}
+
+	if call != nil {
+		ctx.Position = call.Function.Position()
+	}
+
+	return ctx
+}
+
+// cancelled returns an error once the context of the evaluation is done.
+func (in *Interpreter) cancelled() *object.Error {
+	if err := in.Context.Err(); err != nil {
+		return newError("evaluation cancelled: %s", err)
+	}
+	return nil
+}
+
+func (in *Interpreter) traceStatement(statement ast.Statement, env *object.Environment) {
+	if in.Tracer != nil {
+		in.Tracer.Statement(statement, env)
+	}
+}
+
+func (in *Interpreter) traceCall(call *ast.CallExpression, fn object.Object, env *object.Environment) {
+	if in.Tracer != nil {
+		in.Tracer.Call(call, fn, env)
+	}
+}
+
+func (in *Interpreter) traceBranch(ie *ast.IfExpression, consequence bool) {
+	if in.Tracer != nil {
+		in.Tracer.Branch(ie, consequence)
+	}
+}
+
+func (in *Interpreter) traceReturn(call *ast.CallExpression, fn object.Object, result object.Object) {
+	if in.Tracer != nil {
+		in.Tracer.Return(call, fn, result)
+	}
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -202,19 +417,21 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := in.Eval(ie.Condition, env)
 
 	if isError(condition) {
 		return condition
 	}
 
+	in.traceBranch(ie, isTruthy(condition))
+
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return in.Eval(ie.Consequence, env)
 	}
 
 	if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return in.Eval(ie.Alternative, env)
 	}
 
 	return NULL
@@ -224,6 +441,8 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	switch {
 	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
 		return evalIntegerInfixExpression(operator, left.(*object.Integer), right.(*object.Integer))
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING && right.Type() == object.STRING:
 		return evalStringInfixExpression(operator, left.(*object.String), right.(*object.String))
 	case operator == "==":
@@ -246,6 +465,9 @@ func evalIntegerInfixExpression(operator string, l *object.Integer, r *object.In
 	case "*":
 		return newIntegerObject(l.Value * r.Value)
 	case "/":
+		if r.Value == 0 {
+			return newError("division by zero")
+		}
 		return newIntegerObject(l.Value / r.Value)
 	case ">":
 		return newBooleanObject(l.Value > r.Value)
@@ -260,6 +482,53 @@ func evalIntegerInfixExpression(operator string, l *object.Integer, r *object.In
 	}
 }
 
+func stringOperands(left object.Object, right object.Object) (*object.String, *object.String, bool) {
+	l, ok := left.(*object.String)
+	if !ok {
+		return nil, nil, false
+	}
+	r, ok := right.(*object.String)
+	return l, r, ok
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER || obj.Type() == object.FLOAT
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// evalFloatInfixExpression evaluates operations between floats, or between
+// a float and an integer, which is converted to a float.
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	l, r := toFloat(left), toFloat(right)
+
+	switch operator {
+	case "+":
+		return newFloatObject(l + r)
+	case "-":
+		return newFloatObject(l - r)
+	case "*":
+		return newFloatObject(l * r)
+	case "/":
+		return newFloatObject(l / r)
+	case ">":
+		return newBooleanObject(l > r)
+	case "<":
+		return newBooleanObject(l < r)
+	case "==":
+		return newBooleanObject(l == r)
+	case "!=":
+		return newBooleanObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
 func evalStringInfixExpression(operator string, l *object.String, r *object.String) object.Object {
 	switch operator {
 	case "+":
@@ -289,10 +558,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusOperatorPrefixExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER {
+	switch r := right.(type) {
+	case *object.Integer:
+		return newIntegerObject(-r.Value)
+	case *object.Float:
+		return newFloatObject(-r.Value)
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	return newIntegerObject(-right.(*object.Integer).Value)
 }
 
 func newBooleanObject(value bool) *object.Boolean {
@@ -315,6 +588,8 @@ func isTruthy(value object.Object) bool {
 	switch value.Type() {
 	case object.INTEGER:
 		return value.(*object.Integer).Value != 0
+	case object.FLOAT:
+		return value.(*object.Float).Value != 0
 	case object.STRING:
 		return value.(*object.String).Value != ""
 	default:
@@ -330,12 +605,12 @@ func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR
 }
 
-func evalIdentifier(name string, env *object.Environment) object.Object {
+func (in *Interpreter) evalIdentifier(name string, env *object.Environment) object.Object {
 	if value, ok := env.Get(name); ok {
 		return value
 	}
 
-	if builtin, ok := builtins[name]; ok {
+	if builtin, ok := in.Builtin(name); ok {
 		return builtin
 	}
 
@@ -362,29 +637,36 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 			return newError("invalid map key type: %s", index.Type())
 		}
 		return evalMapIndexExpression(l, k)
+	case *object.Struct:
+		name, ok := index.(*object.String)
+		if !ok {
+			return newError("invalid index type: %s", index.Type())
+		}
+		return evalStructIndexExpression(l, name.Value)
 	default:
 		return newError("could not index %s", left.Type())
 	}
 }
 
 func evalArrayIndexExpression(arr *object.Array, index *object.Integer) object.Object {
-	idx := index.Value
+	idx, ok := normalizeIndex(index.Value, int64(len(arr.Elements)))
 
-	if idx < 0 || idx >= int64(len(arr.Elements)) {
-		return newError("index out of range [%d] with length %d", idx, len(arr.Elements))
+	if !ok {
+		return newError("index out of range [%d] with length %d", index.Value, len(arr.Elements))
 	}
 
 	return arr.Elements[idx]
 }
 
 func evalStringIndexExpression(str *object.String, index *object.Integer) object.Object {
-	idx := index.Value
+	length := int64(str.Len())
+	idx, ok := normalizeIndex(index.Value, length)
 
-	if idx < 0 || idx >= int64(len(str.Value)) {
-		return newError("index out of range [%d] with length %d", idx, len(str.Value))
+	if !ok {
+		return newError("index out of range [%d] with length %d", index.Value, length)
 	}
 
-	return newStringObject(string(str.Value[idx]))
+	return newStringObject(str.Substring(int(idx), int(idx)+1))
 }
 
 func evalMapIndexExpression(l *object.Map, i object.Hashable) object.Object {
@@ -398,6 +680,10 @@ func newIntegerObject(value int64) *object.Integer {
 	return &object.Integer{Value: value}
 }
 
+func newFloatObject(value float64) *object.Float {
+	return &object.Float{Value: value}
+}
+
 func newStringObject(value string) *object.String {
 	return &object.String{Value: value}
 }
@@ -1,9 +1,16 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"example.com/writing-an-interpreter/ast"
 	"example.com/writing-an-interpreter/lexer"
 	"example.com/writing-an-interpreter/object"
 	"example.com/writing-an-interpreter/parser"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -217,6 +224,18 @@ if (10 > 1) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"invalid map key type: FUNCTION",
 		},
+		{
+			"10 / (5 - 5)",
+			"division by zero",
+		},
+		{
+			"fn(x) { x }()",
+			"expected 1 argument, received 0",
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"expected 2 arguments, received 1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -295,6 +314,25 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestCallDepth(t *testing.T) {
+	in := NewInterpreter()
+	env := object.NewEnvironment()
+	eval := func(input string) object.Object {
+		return in.Eval(parser.NewParser(lexer.NewLexer(input)).ParseProgram(), env)
+	}
+
+	err, ok := eval("let f = fn() { f() }; f();").(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error for an unbounded recursion")
+	}
+	if expected := "maximum call depth of 10000 exceeded"; err.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Message)
+	}
+
+	// The calls that failed no longer count.
+	testIntegerObject(t, eval("let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(9999);"), 9999)
+}
+
 func TestEnclosingEnvironments(t *testing.T) {
 	input := `
 let first = 10;
@@ -413,6 +451,9 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`last(1)`, "invalid argument for the `last` function, got INTEGER"},
 		{`skip([1, 2, 3], 1)`, []int{2, 3}},
 		{`skip([], 1)`, []int{}},
+		{`skip([1, 2], 3)`, []int{}},
+		{`skip([1, 2], -1)`, []int{1, 2}},
+		{`skip(1, 1)`, "invalid argument for the `skip` function, got INTEGER"},
 		{`append([], 1)`, []int{1}},
 		{`append(1, 1)`, "invalid argument for the `append` function, got INTEGER"},
 	}
@@ -515,7 +556,15 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
-			"index out of range [-1] with length 3",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
+			"index out of range [-4] with length 3",
 		},
 	}
 	for _, tt := range tests {
@@ -538,6 +587,96 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello"[1]`, "e"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`let s = "日本語"; s[len(s) - 1]`, "語"},
+		{`"héllo"[5]`, "index out of range [5] with length 5"},
+		{`"日本語"[-1]`, "語"},
+		{`"日本語"[-4]`, "index out of range [-4] with length 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		var actual string
+		switch result := evaluated.(type) {
+		case *object.String:
+			actual = result.Value
+		case *object.Error:
+			actual = result.Message
+		default:
+			t.Errorf("%s: unexpected result %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][:-1]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][1::2]", "[2, 4]"},
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-1:-3:-1]", "[5, 4]"},
+		{"[1, 2, 3, 4, 5][::-2]", "[5, 3, 1]"},
+		// Out of range bounds are clamped, and empty ranges give empty slices.
+		{"[1, 2, 3][-10:10]", "[1, 2, 3]"},
+		{"[1, 2, 3][5:]", "[]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"[1, 2, 3][1:2:-1]", "[]"},
+		{"[1, 2, 3][10:-10:-1]", "[3, 2, 1]"},
+		{"[][:]", "[]"},
+		// Steps beyond the length do not overflow the indices.
+		{"[1, 2, 3][1::9223372036854775807]", "[2]"},
+		{"[1, 2, 3][::-9223372036854775807]", "[3]"},
+		{"[1, 2, 3][-10:10:9223372036854775807]", "[1]"},
+		{`"héllo"[1::9223372036854775807]`, "é"},
+		{`"héllo"[::-9223372036854775807]`, "o"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-3:]`, "llo"},
+		{`"héllo"[::-1]`, "olléh"},
+		{`"héllo"[4:1]`, ""},
+		{`let xs = [1, 2, 3]; let ys = xs[:]; len(append(ys, 4)) + len(xs)`, "7"},
+		{"[1, 2, 3][::0]", "slice step cannot be zero"},
+		{`[1, 2, 3]["a":]`, "invalid slice index type: STRING"},
+		{`{"a": 1}[1:]`, "could not slice MAP"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		var actual string
+		if err, ok := evaluated.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = evaluated.Inspect()
+		}
+
+		if actual != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
 func TestMapLiterals(t *testing.T) {
 	input := `let two = "two";
 {
@@ -617,3 +756,671 @@ func TestMapIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) Statement(statement ast.Statement, _ *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("statement %d", statement.Position().Line))
+}
+
+func (r *recordingTracer) Call(call *ast.CallExpression, _ object.Object, _ *object.Environment) {
+	r.events = append(r.events, "call "+call.Function.String())
+}
+
+func (r *recordingTracer) Return(call *ast.CallExpression, _ object.Object, result object.Object) {
+	r.events = append(r.events, "return "+call.Function.String()+" "+result.Inspect())
+}
+
+func (r *recordingTracer) Branch(ie *ast.IfExpression, consequence bool) {
+	r.events = append(r.events, fmt.Sprintf("branch %d %t", ie.Position().Line, consequence))
+}
+
+func TestTracer(t *testing.T) {
+	input := `let f = fn(x) {
+	if (x) { len(x) }
+};
+f("ab")`
+
+	tracer := &recordingTracer{}
+	in := NewInterpreter()
+	in.Tracer = tracer
+
+	program := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	testIntegerObject(t, in.Eval(program, object.NewEnvironment()), 2)
+
+	expected := []string{
+		"statement 1",
+		"statement 4",
+		"call f",
+		"statement 2",
+		"branch 2 true",
+		"statement 2",
+		"call len",
+		"return len 2",
+		"return f 2",
+	}
+
+	if strings.Join(tracer.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events. expected=%q, got=%q", expected, tracer.events)
+	}
+}
+
+func TestApply(t *testing.T) {
+	env := object.NewEnvironment()
+	in := NewInterpreter()
+	in.Eval(parser.NewParser(lexer.NewLexer("let add = fn(a, b) { a + b };")).ParseProgram(), env)
+	add, _ := env.Get("add")
+
+	testIntegerObject(t, in.Apply(add, newIntegerObject(1), newIntegerObject(2)), 3)
+	testIntegerObject(t, in.Apply(mustBuiltin(t, in, "len"), newStringObject("abc")), 3)
+
+	err, ok := in.Apply(add, newIntegerObject(1)).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error for a missing argument")
+	}
+	if err.Message != "expected 2 arguments, received 1" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("1.5") + 1`, "2.5"},
+		{`2 * json_parse("0.25")`, "0.5"},
+		{`-json_parse("1.5")`, "-1.5"},
+		{`json_parse("1.5") > 1`, "true"},
+		{`json_parse("2.0") == 2`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// String literals cannot contain quotes, so the JSON documents are
+	// bound to data.
+	tests := []struct {
+		data     string
+		input    string
+		expected string
+	}{
+		{`[1, 2.5, "a", true, null]`, `json_parse(data)`, "[1, 2.5, a, true, null]"},
+		{`{"a": {"b": [1]}}`, `json_parse(data)["a"]["b"][0]`, "1"},
+		{`12345678901234567890`, `json_parse(data)`, "1.2345678901234567e+19"},
+		{`[1,`, `json_parse(data)`, "ERROR: json_parse: unexpected EOF"},
+		{`1 2`, `json_parse(data)`, "ERROR: json_parse: unexpected data after the JSON value"},
+		{`{"a": [1, {"b": "c"}]}`, `json_stringify(json_parse(data))`, `{"a":[1,{"b":"c"}]}`},
+		{``, `json_stringify({"b": [1, json_parse("2.5"), "<x>"], "a": null, 1: true})`, `{"1":true,"a":null,"b":[1,2.5,"<x>"]}`},
+		{``, `json_stringify([1, [2]], 2)`, "[\n  1,\n  [\n    2\n  ]\n]"},
+		{"\t", `json_stringify({"a": 1}, data)`, "{\n\t\"a\": 1\n}"},
+		{``, `json_stringify(fn(x) { x })`, "ERROR: json_stringify: unsupported value type FUNCTION"},
+		{``, `json_stringify({1: "a", "1": "b"})`, `ERROR: json_stringify: duplicate map key "1"`},
+		{``, `json_stringify({true: 1, "true": 2})`, `ERROR: json_stringify: duplicate map key "true"`},
+		{``, `json_stringify([len])`, "ERROR: json_stringify: unsupported value type BUILTIN"},
+		{``, `json_stringify(1, true)`, "ERROR: invalid argument for the `json_stringify` function, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("data", newStringObject(tt.data))
+		evaluated := Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	cyclic := &object.Array{}
+	cyclic.Elements = []object.Object{newIntegerObject(1), cyclic}
+
+	if result := builtinJSONStringify(&object.BuiltinContext{}, cyclic); result.Inspect() != "ERROR: json_stringify: cyclic array" {
+		t.Errorf("wrong result for a cyclic array. got=%q", result.Inspect())
+	}
+
+	shared := &object.Array{Elements: []object.Object{newIntegerObject(1)}}
+	if result := builtinJSONStringify(&object.BuiltinContext{}, &object.Array{Elements: []object.Object{shared, shared}}); result.Inspect() != "[[1],[1]]" {
+		t.Errorf("wrong result for a shared array. got=%q", result.Inspect())
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`map([1, true], fn(x) { -x })`, "ERROR: unknown operator: -BOOLEAN"},
+		{`map([1], fn(x, y) { x })`, "ERROR: expected 2 arguments, received 1"},
+		{`map(1, fn(x) { x })`, "ERROR: invalid argument for the `map` function, got INTEGER"},
+		{`map([1], 1)`, "ERROR: invalid argument for the `map` function, got INTEGER"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x })`, "6"},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x }, 10)`, "16"},
+		{`reduce([], fn(acc, x) { acc + x })`, "ERROR: reduce of an empty array with no initial value"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { b - a })`, "[3, 2, 1]"},
+		{`sort([[2, "b"], [1, "a"], [2, "a"]], fn(a, b) { a[0] - b[0] })`, "[[1, a], [2, b], [2, a]]"},
+		{`sort([1, "a"])`, "ERROR: could not compare STRING and INTEGER, pass a comparator to sort"},
+		{`sort([1, 2], fn(a, b) { true })`, "ERROR: sort comparator must return an INTEGER, got BOOLEAN"},
+		{`let xs = [2, 1]; sort(xs); xs`, "[2, 1]"},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`any([1, 2, 3], fn(x) { x > 3 })`, "false"},
+		{`any([0, null])`, "false"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([1, 0])`, "false"},
+		{`all([])`, "true"},
+		{`find([1, 2, 3], fn(x) { x > 1 })`, "2"},
+		{`find([1, 2, 3], fn(x) { x > 3 })`, "null"},
+		{`find([0, null, 3, 4])`, "3"},
+		{`find([1], fn(x) { x }, 2)`, "ERROR: expected 1 or 2 arguments, received 3"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`zip([1])`, "ERROR: expected at least 2 arguments, received 1"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`range(0)`, "[]"},
+		{`range(0, 1, 0)`, "ERROR: range step cannot be 0"},
+		{`enumerate(["a", "b"])`, "[[0, a], [1, b]]"},
+		{`let map = fn(x) { x }; map(1)`, "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBuiltinContext(t *testing.T) {
+	var out strings.Builder
+	var ctx *object.BuiltinContext
+
+	env := object.NewEnvironment()
+	env.Set("capture", &object.Builtin{Fn: func(c *object.BuiltinContext, args ...object.Object) object.Object {
+		ctx = c
+		return c.Apply(args[0], newIntegerObject(2))
+	}})
+
+	in := NewInterpreter()
+	in.Out = &out
+	program := parser.NewParser(lexer.NewLexer("print(\"a\", 1);\nlet x = 1;\n  capture(fn(n) { n * 10 })")).ParseProgram()
+	result := in.Eval(program, env)
+
+	testIntegerObject(t, result, 20)
+
+	if out.String() != "a 1\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "a 1\n", out.String())
+	}
+	if ctx.Position.Line != 3 || ctx.Position.Column != 3 {
+		t.Errorf("wrong call site position. got=%+v", ctx.Position)
+	}
+	if x, ok := ctx.Environment.Get("x"); !ok || x.Inspect() != "1" {
+		t.Errorf("wrong call site environment. x=%v", x)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := NewInterpreter()
+	in.Context = ctx
+
+	env := object.NewEnvironment()
+	env.Set("cancel", object.SimpleBuiltin(func(args ...object.Object) object.Object {
+		cancel()
+		return NULL
+	}))
+
+	program := parser.NewParser(lexer.NewLexer(`let loop = fn(n) { if (n == 2) { cancel() }; loop(n + 1) }; loop(0)`)).ParseProgram()
+	result := in.Eval(program, env)
+
+	err, ok := result.(*object.Error)
+	if !ok || err.Message != "evaluation cancelled: context canceled" {
+		t.Errorf("expected the evaluation to be cancelled. got=%v", result)
+	}
+
+	// With no memory limit, a range too long to be built stops once
+	// cancelled.
+	ctx, cancel = context.WithCancel(context.Background())
+	in.Context = ctx
+	env.Set("huge", object.SimpleBuiltin(func(args ...object.Object) object.Object {
+		cancel()
+		return newIntegerObject(1000000000000)
+	}))
+
+	program = parser.NewParser(lexer.NewLexer(`range(huge())`)).ParseProgram()
+	result = in.Eval(program, env)
+
+	err, ok = result.(*object.Error)
+	if !ok || err.Message != "evaluation cancelled: context canceled" {
+		t.Errorf("expected the range to be cancelled. got=%.100s", result.Inspect())
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	t.Setenv("MANDRILL_TEST_VARIABLE", "set")
+
+	env := object.NewEnvironment()
+	env.Set("path", newStringObject(path))
+
+	tests := []struct {
+		input    string
+		granted  object.Capability
+		expected string
+	}{
+		{`write_file(path, "hello")`, 0, "`write_file` needs filesystem access, which is not granted"},
+		{`read_file(path)`, object.Network, "`read_file` needs filesystem access, which is not granted"},
+		{`getenv("MANDRILL_TEST_VARIABLE")`, object.Filesystem, "`getenv` needs environment variable access, which is not granted"},
+		{`now()`, object.AllCapabilities &^ object.Clock, "`now` needs clock access, which is not granted"},
+		{`quote()`, object.EnvironmentVariables, "`quote` needs network access, which is not granted"},
+		{`quote()`, 0, "`quote` needs network, environment variable access, which is not granted"},
+		{`write_file(path, "hello"); read_file(path)`, object.Filesystem, "hello"},
+		{`getenv("MANDRILL_TEST_VARIABLE")`, object.EnvironmentVariables, "set"},
+		{`getenv("MANDRILL_TEST_UNSET_VARIABLE")`, object.EnvironmentVariables, "null"},
+		{`now() > 0`, object.Clock, "true"},
+	}
+
+	for _, tt := range tests {
+		in := NewInterpreter()
+		in.Capabilities = tt.granted
+		result := in.Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+
+		var actual string
+		if err, ok := result.(*object.Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+
+		if actual != tt.expected {
+			t.Errorf("%s with %q granted: expected=%q, got=%q", tt.input, tt.granted, tt.expected, actual)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    int64
+		exceeded bool
+	}{
+		{`let grow = fn(xs) { grow(append(xs, len(xs))) }; grow([])`, 10000, true},
+		{`let grow = fn(s) { grow(s + s) }; grow("a")`, 10000, true},
+		{`map(range(0, 1000), fn(x) { {"x": x} })`, 10000, true},
+		{`let xs = map(range(0, 10), fn(x) { [x] }); len(xs)`, 10000, false},
+		{`let grow = fn(xs, n) { if (n == 0) { len(xs) } else { grow(append(xs, n), n - 1) } }; grow([], 100)`, 0, false},
+		{`let s = json_stringify(range(1000));
+		let xs = [s];
+		let m = {"s": s};
+		let read = fn(n) {
+			if (n > 0) { first(xs); last(xs); find(xs, fn(x) { true }); filter(xs, fn(x) { true }); m["s"]; read(n - 1) }
+		};
+		read(200)`, 100000, false},
+	}
+
+	// The offsets of the runes of a string are cached once it is indexed.
+	double := `let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; let s = double("é", 15); `
+	for _, index := range []string{"", "len(s)", "s[1]", "s[1:]", "skip(s, 1)"} {
+		tests = append(tests, struct {
+			input    string
+			limit    int64
+			exceeded bool
+		}{double + index, 200000, index != ""})
+	}
+
+	for _, tt := range tests {
+		in := NewInterpreter()
+		in.MemoryLimit = tt.limit
+		result := in.Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), object.NewEnvironment())
+
+		err, ok := result.(*object.Error)
+		if exceeded := ok && strings.HasPrefix(err.Message, "memory limit exceeded"); exceeded != tt.exceeded {
+			t.Errorf("%s: expected the limit to be exceeded: %t, got=%s", tt.input, tt.exceeded, result.Inspect())
+		}
+	}
+}
+
+func TestMemoryReservations(t *testing.T) {
+	tests := []string{
+		`range(200000000)`,
+		`range(-9223372036854775807, 9223372036854775807)`,
+		`split(json_stringify(range(100000)), "")`,
+		`json_stringify([1], 100000000)`,
+		`let xs = range(60000); append(xs, 1)`,
+		`let grow = fn(xs) { grow(append(xs, len(xs))) }; grow([])`,
+		`let grow = fn(s) { grow(s + s) }; grow("a")`,
+		`let s = json_stringify(range(3000)); replace(s, "", s)`,
+		`let s = json_stringify(range(20000)); join([s, s, s, s, s], s)`,
+		`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } };
+		let s = double("a", 18);
+		[upper(s), lower(s), trim(s)]`,
+	}
+
+	for _, tt := range tests {
+		in := NewInterpreter()
+		in.MemoryLimit = 1000000
+		result := in.Eval(parser.NewParser(lexer.NewLexer(tt)).ParseProgram(), object.NewEnvironment())
+
+		err, ok := result.(*object.Error)
+		if !ok || !strings.HasPrefix(err.Message, "memory limit exceeded") {
+			t.Errorf("%s: expected the limit to be exceeded, got=%.100s", tt, result.Inspect())
+		}
+		// The values are not created once they would exceed the limit.
+		if in.Allocated() > in.MemoryLimit {
+			t.Errorf("%s: expected at most %d bytes to be allocated, got=%d", tt, in.MemoryLimit, in.Allocated())
+		}
+	}
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"let x = 1;\nx + true", 2, 3},
+		{"let f = fn(n) {\n  -true\n};\nf(1)", 2, 3},
+		{"len(1, 2)", 1, 4},
+		{"let xs = [1];\n\nxs[5]", 3, 3},
+		{"missing", 1, 1},
+	}
+
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+
+		d := ErrorDiagnostic(err)
+		if d.Code != "runtime-error" || d.Message != err.Message {
+			t.Errorf("%q: wrong diagnostic. got=%+v", tt.input, d)
+		}
+		if d.Range.Start.Line != tt.line || d.Range.Start.Column != tt.column {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%d:%d", tt.input,
+				tt.line, tt.column, d.Range.Start.Line, d.Range.Start.Column)
+		}
+	}
+}
+
+func mustBuiltin(t *testing.T, in *Interpreter, name string) *object.Builtin {
+	t.Helper()
+	builtin, ok := in.Builtin(name)
+	if !ok {
+		t.Fatalf("builtin %s is not enabled", name)
+	}
+	return builtin
+}
+
+func TestModules(t *testing.T) {
+	eval := func(in *Interpreter, input string) object.Object {
+		return in.Eval(parser.NewParser(lexer.NewLexer(input)).ParseProgram(), object.NewEnvironment())
+	}
+
+	in := NewInterpreter()
+	expected := []string{"core", "strings", "math", "json", "io", "net"}
+	if fmt.Sprint(in.Modules()) != fmt.Sprint(expected) {
+		t.Errorf("wrong modules. expected=%v, got=%v", expected, in.Modules())
+	}
+
+	in.DisableModule("net")
+	if result := eval(in, "quote()"); result.Inspect() != "ERROR: identifier not found: quote" {
+		t.Errorf("expected quote to be disabled. got=%s", result.Inspect())
+	}
+
+	var printed []string
+	fakeIO := &Module{Name: "io"}
+	fakeIO.Register("print", object.SimpleBuiltin(func(args ...object.Object) object.Object {
+		printed = append(printed, args[0].Inspect())
+		return NULL
+	}))
+	fakeIO.Register("twice", &object.Builtin{Fn: func(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+		return ctx.Apply(args[0], ctx.Apply(args[0], args[1]))
+	}})
+	in.EnableModule(fakeIO)
+
+	testIntegerObject(t, eval(in, `print("hi"); twice(fn(x) { x * 3 }, 2)`), 18)
+	if fmt.Sprint(printed) != "[hi]" {
+		t.Errorf("wrong output of the fake print. got=%v", printed)
+	}
+
+	overrides := &Module{Name: "overrides"}
+	overrides.Register("len", object.SimpleBuiltin(func(args ...object.Object) object.Object {
+		return newIntegerObject(-1)
+	}))
+	in.EnableModule(overrides)
+	testIntegerObject(t, eval(in, `len("abc")`), -1)
+
+	in.DisableModule("overrides")
+	testIntegerObject(t, eval(in, `len("abc")`), 3)
+
+	if _, ok := StandardModule("missing"); ok {
+		t.Errorf("expected no module named missing")
+	}
+	core, _ := StandardModule("core")
+	if !strings.Contains(strings.Join(core.Names(), " "), "enumerate filter find") {
+		t.Errorf("wrong core functions. got=%v", core.Names())
+	}
+}
+
+func TestStringAndMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`join(["a", "b"], "-")`, "a-b"},
+		{`join(["a", 1], "-")`, "ERROR: invalid argument for the `join` function, got INTEGER"},
+		{`upper("abc")`, "ABC"},
+		{`lower("ABC")`, "abc"},
+		{`trim("  a b ")`, "a b"},
+		{`contains("monkey", "key")`, "true"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`upper(1)`, "ERROR: invalid argument for the `upper` function, got INTEGER"},
+		{`abs(-3)`, "3"},
+		{`abs(json_parse("-1.5"))`, "1.5"},
+		{`min(3, 1, 2)`, "1"},
+		{`max([3, json_parse("4.5"), 2])`, "4.5"},
+		{`max([])`, "ERROR: max of no values"},
+		{`pow(2, 10)`, "1024"},
+		{`pow(2, -1)`, "0.5"},
+		{`pow(1, 9223372036854775807)`, "1"},
+		{`pow(-1, 9223372036854775807)`, "-1"},
+		{`pow(0, 9223372036854775807)`, "0"},
+		{`pow(2, 62)`, "4611686018427387904"},
+		{`pow(-2, 63)`, "-9223372036854775808"},
+		{`pow(2, 63)`, "ERROR: integer overflow: pow(2, 63)"},
+		{`abs(-9223372036854775807 - 1)`, "ERROR: integer overflow: abs(-9223372036854775808)"},
+		{`abs(-9223372036854775807)`, "9223372036854775807"},
+		{`pow(3, 9223372036854775807)`, "ERROR: integer overflow: pow(3, 9223372036854775807)"},
+		{`sqrt(16)`, "4.0"},
+		{`sqrt(-1)`, "ERROR: square root of negative number -1"},
+		{`floor(json_parse("2.7"))`, "2"},
+		{`ceil(json_parse("2.1"))`, "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+type testUser struct {
+	Name    string
+	Age     int
+	Tags    []string
+	private int
+}
+
+func (u *testUser) Greet(greeting string) string {
+	return greeting + ", " + u.Name
+}
+
+func (u *testUser) Birthday() {
+	u.Age++
+}
+
+type testProfile struct {
+	Bio string
+}
+
+type testAccount struct {
+	*testProfile
+	Friends []any
+}
+
+func TestBind(t *testing.T) {
+	module := &Module{Name: "host"}
+	bindings := map[string]any{
+		"repeat": strings.Repeat,
+		"divide": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a / b, nil
+		},
+		"sum": func(xs ...float64) float64 {
+			total := 0.0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		},
+		"keys": func(m map[string]int) []string {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		},
+		"describe":  func(v any) string { return fmt.Sprintf("%T %v", v, v) },
+		"small":     func(b int8) int8 { return b },
+		"cancelled": func(ctx context.Context) bool { return ctx.Err() != nil },
+		"split":     func(s string) (string, string) { return s[:1], s[1:] },
+		"older":     func(u *testUser) int { return u.Age + 1 },
+		"panics":    func() { panic("oops") },
+	}
+	for name, fn := range bindings {
+		if err := module.RegisterFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := module.RegisterFunc("user", testUser{}); err == nil {
+		t.Errorf("expected an error registering a struct as a function")
+	}
+
+	user, err := Bind(&testUser{Name: "Ada", Age: 36, Tags: []string{"math"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	friends := []any{nil}
+	friends[0] = friends
+	account, err := Bind(&testAccount{Friends: friends})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab")`, "ERROR: expected 2 arguments, received 1"},
+		{`repeat("ab", "c")`, "ERROR: argument 2: cannot use STRING as int"},
+		{`divide(7, 2)`, "3"},
+		{`divide(1, 0)`, "ERROR: division by zero"},
+		{`sum()`, "0.0"},
+		{`sum(1, json_parse("1.5"))`, "2.5"},
+		{`keys({"b": 1, "a": 2})`, "[a, b]"},
+		{`keys({"a": "x"})`, "ERROR: argument 1: cannot use STRING as int"},
+		{`describe([1, "a", null])`, "[]interface {} [1 a <nil>]"},
+		{`small(300)`, "ERROR: argument 1: 300 overflows int8"},
+		{`cancelled()`, "false"},
+		{`split("abc")`, "[a, bc]"},
+		{`panics()`, "ERROR: Go function panicked: oops"},
+		{`user["Name"]`, "Ada"},
+		{`user["Tags"]`, "[math]"},
+		{`user["Greet"]("Hello")`, "Hello, Ada"},
+		{`user["Birthday"](); user["Age"]`, "37"},
+		{`older(user)`, "38"},
+		{`older(1)`, "ERROR: argument 1: cannot use INTEGER as *evaluator.testUser"},
+		{`user["private"]`, "ERROR: evaluator.testUser has no field or method private"},
+		{`user[1]`, "ERROR: invalid index type: INTEGER"},
+		{`account["Bio"]`, "ERROR: cannot read Bio: reflect: indirection through nil pointer to embedded struct field testProfile"},
+		{`account["Friends"]`, "ERROR: cannot bind a cyclic value of type []interface {}"},
+	}
+
+	for _, tt := range tests {
+		in := NewInterpreter()
+		in.EnableModule(module)
+		env := object.NewEnvironment()
+		env.Set("user", user)
+		env.Set("account", account)
+		evaluated := in.Eval(parser.NewParser(lexer.NewLexer(tt.input)).ParseProgram(), env)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	values := []struct {
+		value    any
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{uint8(7), "7"},
+		{[]byte("bytes"), "bytes"},
+		{[2]int{1, 2}, "[1, 2]"},
+		{map[int]bool{1: true}, "{1: true}"},
+		{errors.New("failed"), "ERROR: failed"},
+		{testUser{Name: "Bob"}, "{Name:Bob Age:0 Tags:[] private:0}"},
+	}
+
+	for _, tt := range values {
+		obj, err := Bind(tt.value)
+		if err != nil {
+			t.Errorf("could not bind %v: %v", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("wrong binding of %#v. expected=%q, got=%q", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, err := Bind(make(chan int)); err == nil {
+		t.Errorf("expected an error binding a channel")
+	}
+
+	cyclicMap := map[string]any{}
+	cyclicMap["self"] = cyclicMap
+	cyclicPointer := new(any)
+	*cyclicPointer = cyclicPointer
+
+	for _, v := range []any{friends, cyclicMap, cyclicPointer} {
+		if _, err := Bind(v); err == nil || !strings.Contains(err.Error(), "cyclic") {
+			t.Errorf("expected an error binding a cyclic %T. got=%v", v, err)
+		}
+	}
+
+	shared := []int{1}
+	if obj, err := Bind([][]int{shared, shared}); err != nil || obj.Inspect() != "[[1], [1]]" {
+		t.Errorf("wrong binding of a slice repeated in another one. got=%v, %v", obj, err)
+	}
+}
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"os"
+	"time"
+)
+
+func builtinReadFile(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if err := ctx.Require("read_file", object.Filesystem); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return newArgumentNumberError(1, len(args), false)
+	}
+
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("read_file", args[0])
+	}
+
+	content, err := os.ReadFile(path.Value)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return allocated(ctx, newStringObject(string(content)))
+}
+
+func builtinWriteFile(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if err := ctx.Require("write_file", object.Filesystem); err != nil {
+		return err
+	}
+
+	if len(args) != 2 {
+		return newArgumentNumberError(2, len(args), false)
+	}
+
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("write_file", args[0])
+	}
+
+	content, ok := args[1].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("write_file", args[1])
+	}
+
+	if err := os.WriteFile(path.Value, []byte(content.Value), 0o644); err != nil {
+		return newError("%s", err)
+	}
+
+	return NULL
+}
+
+// builtinGetenv returns the value of an environment variable, or null if it
+// is not set.
+func builtinGetenv(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if err := ctx.Require("getenv", object.EnvironmentVariables); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return newArgumentNumberError(1, len(args), false)
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("getenv", args[0])
+	}
+
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return NULL
+	}
+
+	return allocated(ctx, newStringObject(value))
+}
+
+// builtinNow returns the current time in milliseconds since the Unix epoch.
+func builtinNow(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if err := ctx.Require("now", object.Clock); err != nil {
+		return err
+	}
+
+	if len(args) != 0 {
+		return newArgumentNumberError(0, len(args), false)
+	}
+
+	return newIntegerObject(time.Now().UnixMilli())
+}
@@ -0,0 +1,184 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func builtinJSONParse(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newArgumentNumberError(1, len(args), false)
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("json_parse", args[0])
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(s.Value))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return newError("json_parse: %s", err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return newError("json_parse: unexpected data after the JSON value")
+	}
+
+	return allocated(ctx, fromJSON(value))
+}
+
+func fromJSON(value any) object.Object {
+	switch v := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return newBooleanObject(v)
+	case string:
+		return newStringObject(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return newIntegerObject(i)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return newError("json_parse: %s", err)
+		}
+		return newFloatObject(f)
+	case []any:
+		elements := make([]object.Object, len(v))
+		for i, e := range v {
+			elements[i] = fromJSON(e)
+			if isError(elements[i]) {
+				return elements[i]
+			}
+		}
+		return &object.Array{Elements: elements}
+	case map[string]any:
+		m := &object.Map{Pairs: make(map[object.HashKey]object.MapPair)}
+		for key, e := range v {
+			k := newStringObject(key)
+			value := fromJSON(e)
+			if isError(value) {
+				return value
+			}
+			m.Pairs[k.HashKey()] = object.MapPair{Key: k, Value: value}
+		}
+		return m
+	default:
+		return newError("json_parse: unexpected value %v", value)
+	}
+}
+
+func builtinJSONStringify(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("expected 1 or 2 arguments, received %d", len(args))
+	}
+
+	var indent string
+
+	if len(args) == 2 {
+		switch i := args[1].(type) {
+		case *object.Integer:
+			if i.Value < 0 {
+				return newError("json_stringify: negative indent %d", i.Value)
+			}
+			if err := ctx.Reserve(stringSize(0) + i.Value); err != nil {
+				return err
+			}
+			indent = strings.Repeat(" ", int(i.Value))
+		case *object.String:
+			indent = i.Value
+		default:
+			return newInvalidArgumentError("json_stringify", args[1])
+		}
+	}
+
+	value, err := toJSON(args[0], make(map[object.Object]bool))
+	if err != nil {
+		return newError("json_stringify: %s", err)
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+
+	if err := encoder.Encode(value); err != nil {
+		return newError("json_stringify: %s", err)
+	}
+
+	return allocated(ctx, newStringObject(strings.TrimSuffix(out.String(), "\n")))
+}
+
+// toJSON converts obj to a value encoding/json can encode, keeping track of
+// the arrays and maps being converted to detect cycles.
+func toJSON(obj object.Object, visiting map[object.Object]bool) (any, error) {
+	switch o := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return o.Value, nil
+	case *object.Integer:
+		return o.Value, nil
+	case *object.Float:
+		return o.Value, nil
+	case *object.String:
+		return o.Value, nil
+	case *object.Array:
+		if visiting[o] {
+			return nil, errors.New("cyclic array")
+		}
+		visiting[o] = true
+		defer delete(visiting, o)
+
+		elements := make([]any, len(o.Elements))
+		for i, e := range o.Elements {
+			value, err := toJSON(e, visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Map:
+		if visiting[o] {
+			return nil, errors.New("cyclic map")
+		}
+		visiting[o] = true
+		defer delete(visiting, o)
+
+		pairs := make(map[string]any, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			var key string
+			switch k := pair.Key.(type) {
+			case *object.String:
+				key = k.Value
+			case *object.Integer, *object.Boolean:
+				key = k.Inspect()
+			default:
+				return nil, fmt.Errorf("unsupported map key type %s", pair.Key.Type())
+			}
+			// Keys such as 1 and "1" are distinct in a map but not in JSON.
+			if _, ok := pairs[key]; ok {
+				return nil, fmt.Errorf("duplicate map key %q", key)
+			}
+
+			value, err := toJSON(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = value
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", obj.Type())
+	}
+}
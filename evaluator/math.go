@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"math"
+)
+
+func numberArgument(name string, args []object.Object) (object.Object, *object.Error) {
+	if len(args) != 1 {
+		return nil, newArgumentNumberError(1, len(args), false)
+	}
+
+	if !isNumber(args[0]) {
+		return nil, newInvalidArgumentError(name, args[0])
+	}
+
+	return args[0], nil
+}
+
+func builtinAbs(args ...object.Object) object.Object {
+	n, err := numberArgument("abs", args)
+	if err != nil {
+		return err
+	}
+
+	if i, ok := n.(*object.Integer); ok {
+		if i.Value == math.MinInt64 {
+			return newError("integer overflow: abs(%d)", i.Value)
+		}
+		if i.Value < 0 {
+			return newIntegerObject(-i.Value)
+		}
+		return i
+	}
+
+	return newFloatObject(math.Abs(toFloat(n)))
+}
+
+func builtinMin(args ...object.Object) object.Object {
+	return extreme("min", args, func(c int64) bool { return c < 0 })
+}
+
+func builtinMax(args ...object.Object) object.Object {
+	return extreme("max", args, func(c int64) bool { return c > 0 })
+}
+
+// extreme returns the argument, or the element of the only argument if it
+// is an array, that is preferred over every other one.
+func extreme(name string, args []object.Object, preferred func(comparison int64) bool) object.Object {
+	if len(args) == 1 {
+		if array, ok := args[0].(*object.Array); ok {
+			args = array.Elements
+		}
+	}
+
+	if len(args) == 0 {
+		return newError("%s of no values", name)
+	}
+
+	result := args[0]
+
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return newInvalidArgumentError(name, arg)
+		}
+		if c, _ := compareObjects(arg, result); preferred(c) {
+			result = arg
+		}
+	}
+
+	return result
+}
+
+// builtinPow returns an integer when raising an integer to a non-negative
+// integer power, or an error if it overflows, and a float otherwise.
+func builtinPow(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newArgumentNumberError(2, len(args), false)
+	}
+
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return newInvalidArgumentError("pow", arg)
+		}
+	}
+
+	base, baseIsInteger := args[0].(*object.Integer)
+	exponent, exponentIsInteger := args[1].(*object.Integer)
+
+	if baseIsInteger && exponentIsInteger && exponent.Value >= 0 {
+		result, ok := powInteger(base.Value, exponent.Value)
+		if !ok {
+			return newError("integer overflow: pow(%d, %d)", base.Value, exponent.Value)
+		}
+		return newIntegerObject(result)
+	}
+
+	return newFloatObject(math.Pow(toFloat(args[0]), toFloat(args[1])))
+}
+
+// powInteger raises base to a non-negative exponent by squaring, reporting
+// whether the result fits in an int64.
+func powInteger(base, exponent int64) (int64, bool) {
+	result := int64(1)
+
+	for ok := true; exponent > 0; {
+		if exponent&1 == 1 {
+			if result, ok = multiplyInteger(result, base); !ok {
+				return 0, false
+			}
+		}
+
+		exponent >>= 1
+
+		if exponent > 0 {
+			if base, ok = multiplyInteger(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+
+	return result, true
+}
+
+// multiplyInteger returns a * b, reporting whether it fits in an int64.
+func multiplyInteger(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	c := a * b
+	if c/b != a || (a == math.MinInt64 && b == -1) {
+		return 0, false
+	}
+
+	return c, true
+}
+
+func builtinSqrt(args ...object.Object) object.Object {
+	n, err := numberArgument("sqrt", args)
+	if err != nil {
+		return err
+	}
+
+	if toFloat(n) < 0 {
+		return newError("square root of negative number %s", n.Inspect())
+	}
+
+	return newFloatObject(math.Sqrt(toFloat(n)))
+}
+
+func builtinFloor(args ...object.Object) object.Object {
+	return rounded("floor", args, math.Floor)
+}
+
+func builtinCeil(args ...object.Object) object.Object {
+	return rounded("ceil", args, math.Ceil)
+}
+
+func rounded(name string, args []object.Object, round func(float64) float64) object.Object {
+	n, err := numberArgument(name, args)
+	if err != nil {
+		return err
+	}
+
+	if i, ok := n.(*object.Integer); ok {
+		return i
+	}
+
+	return newIntegerObject(int64(round(toFloat(n))))
+}
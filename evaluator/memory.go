@@ -0,0 +1,142 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+)
+
+// Approximate sizes in bytes of the values making up strings, arrays and
+// maps on a 64-bit platform.
+const (
+	stringHeaderSize = 16
+	sliceHeaderSize  = 24
+	interfaceSize    = 16
+	mapHeaderSize    = 48
+	// A map entry holds a HashKey and a MapPair, plus the bucket overhead.
+	mapEntrySize = 64
+)
+
+// sizeOf returns the approximate number of bytes allocated to create obj
+// and the strings, arrays and maps it contains, or 0 for objects that are not
+// strings, arrays or maps.
+func sizeOf(obj object.Object) int64 {
+	return nestedSize(obj, make(map[object.Object]bool))
+}
+
+// nestedSize is sizeOf, counting the arrays and maps in seen only once.
+func nestedSize(obj object.Object, seen map[object.Object]bool) int64 {
+	switch o := obj.(type) {
+	case *object.Array, *object.Map:
+		if seen[o] {
+			return 0
+		}
+		seen[o] = true
+	}
+
+	size := headerSize(obj)
+
+	switch o := obj.(type) {
+	case *object.Array:
+		for _, e := range o.Elements {
+			size += nestedSize(e, seen)
+		}
+	case *object.Map:
+		for _, pair := range o.Pairs {
+			size += nestedSize(pair.Key, seen) + nestedSize(pair.Value, seen)
+		}
+	}
+
+	return size
+}
+
+// headerSize returns the approximate number of bytes allocated to create
+// obj, not counting the objects it contains.
+func headerSize(obj object.Object) int64 {
+	switch o := obj.(type) {
+	case *object.String:
+		return stringSize(len(o.Value))
+	case *object.Array:
+		return arraySize(len(o.Elements))
+	case *object.Map:
+		return mapHeaderSize + mapEntrySize*int64(len(o.Pairs))
+	default:
+		return 0
+	}
+}
+
+func stringSize(n int) int64 {
+	return stringHeaderSize + int64(n)
+}
+
+func arraySize(n int) int64 {
+	return sliceHeaderSize + interfaceSize*int64(n)
+}
+
+// allocate accounts for obj and the objects it contains, which have just
+// been created, returning it, or an error once the memory limit of the
+// interpreter is exceeded.
+func (in *Interpreter) allocate(obj object.Object) object.Object {
+	return in.account(obj, sizeOf(obj))
+}
+
+// allocateContainer is allocate for an array or a map made of objects
+// accounted for already.
+func (in *Interpreter) allocateContainer(obj object.Object) object.Object {
+	return in.account(obj, headerSize(obj))
+}
+
+func (in *Interpreter) account(obj object.Object, size int64) object.Object {
+	if err := in.Allocate(size); err != nil {
+		return err
+	}
+	return obj
+}
+
+// Allocate accounts for the given number of bytes, allocated by a built-in
+// function to create the values it returns, returning an error once the
+// memory limit of the interpreter is exceeded.
+func (in *Interpreter) Allocate(bytes int64) *object.Error {
+	in.allocated += bytes
+
+	if in.MemoryLimit > 0 && in.allocated > in.MemoryLimit {
+		return newError("memory limit exceeded: %d bytes allocated, the limit is %d", in.allocated, in.MemoryLimit)
+	}
+
+	return nil
+}
+
+// allocated accounts for obj, which a built-in function has just created
+// along with the objects it contains, returning it, or an error once the
+// memory limit is exceeded.
+func allocated(ctx *object.BuiltinContext, obj object.Object) object.Object {
+	return accounted(ctx, obj, sizeOf(obj))
+}
+
+// allocatedContainer is allocated for an array or a map made of objects
+// that already existed.
+func allocatedContainer(ctx *object.BuiltinContext, obj object.Object) object.Object {
+	return accounted(ctx, obj, headerSize(obj))
+}
+
+func accounted(ctx *object.BuiltinContext, obj object.Object, size int64) object.Object {
+	if err := ctx.Allocate(size); err != nil {
+		return err
+	}
+	return obj
+}
+
+// Reserve returns an error when allocating the given number of bytes would
+// exceed the memory limit, for built-in functions to fail before creating
+// large values, which they account for with Allocate once created.
+func (in *Interpreter) Reserve(bytes int64) *object.Error {
+	if in.MemoryLimit > 0 && bytes > in.MemoryLimit-in.allocated {
+		return newError("memory limit exceeded: %d bytes requested, %d bytes allocated, the limit is %d", bytes, in.allocated, in.MemoryLimit)
+	}
+
+	return nil
+}
+
+// Allocated returns the approximate number of bytes allocated to strings,
+// arrays and maps by the programs evaluated so far.
+func (in *Interpreter) Allocated() int64 {
+	return in.allocated
+}
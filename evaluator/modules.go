@@ -0,0 +1,154 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"sort"
+)
+
+// Module is a named group of built-in functions that can be enabled on an
+// interpreter.
+type Module struct {
+	Name     string
+	Builtins map[string]*object.Builtin
+}
+
+// Register adds fn to the module under the given name, replacing any
+// function already registered with it.
+func (m *Module) Register(name string, fn *object.Builtin) {
+	if m.Builtins == nil {
+		m.Builtins = make(map[string]*object.Builtin)
+	}
+	m.Builtins[name] = fn
+}
+
+func (m *Module) Names() []string {
+	return sortedNames(m.Builtins)
+}
+
+// standardModules returns the modules enabled on every new interpreter.
+func standardModules() []*Module {
+	return []*Module{
+		{Name: "core", Builtins: map[string]*object.Builtin{
+			"len":       {Fn: builtinLen},
+			"append":    {Fn: builtinAppend},
+			"first":     {Fn: builtinFirst},
+			"last":      {Fn: builtinLast},
+			"skip":      {Fn: builtinSkip},
+			"map":       {Fn: builtinMap},
+			"filter":    {Fn: builtinFilter},
+			"reduce":    {Fn: builtinReduce},
+			"sort":      {Fn: builtinSort},
+			"any":       {Fn: builtinAny},
+			"all":       {Fn: builtinAll},
+			"find":      {Fn: builtinFind},
+			"zip":       {Fn: builtinZip},
+			"range":     {Fn: builtinRange},
+			"enumerate": {Fn: builtinEnumerate},
+		}},
+		{Name: "strings", Builtins: map[string]*object.Builtin{
+			"split":    {Fn: builtinSplit},
+			"join":     {Fn: builtinJoin},
+			"upper":    {Fn: builtinUpper},
+			"lower":    {Fn: builtinLower},
+			"trim":     {Fn: builtinTrim},
+			"contains": object.SimpleBuiltin(builtinContains),
+			"replace":  {Fn: builtinReplace},
+		}},
+		{Name: "math", Builtins: map[string]*object.Builtin{
+			"abs":   object.SimpleBuiltin(builtinAbs),
+			"min":   object.SimpleBuiltin(builtinMin),
+			"max":   object.SimpleBuiltin(builtinMax),
+			"pow":   object.SimpleBuiltin(builtinPow),
+			"sqrt":  object.SimpleBuiltin(builtinSqrt),
+			"floor": object.SimpleBuiltin(builtinFloor),
+			"ceil":  object.SimpleBuiltin(builtinCeil),
+		}},
+		{Name: "json", Builtins: map[string]*object.Builtin{
+			"json_parse":     {Fn: builtinJSONParse},
+			"json_stringify": {Fn: builtinJSONStringify},
+		}},
+		{Name: "io", Builtins: map[string]*object.Builtin{
+			"print":      {Fn: builtinPrint},
+			"read_file":  {Fn: builtinReadFile},
+			"write_file": {Fn: builtinWriteFile},
+			"getenv":     {Fn: builtinGetenv},
+			"now":        {Fn: builtinNow},
+		}},
+		{Name: "net", Builtins: map[string]*object.Builtin{
+			"quote": {Fn: builtinQuote},
+		}},
+	}
+}
+
+// StandardModule returns a copy of the standard module with the given name,
+// one of "core", "strings", "math", "json", "io" and "net".
+func StandardModule(name string) (*Module, bool) {
+	for _, m := range standardModules() {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// BuiltinNames returns the names of the functions of the standard modules.
+func BuiltinNames() []string {
+	return NewInterpreter().BuiltinNames()
+}
+
+// EnableModule makes the functions of m available to the programs evaluated
+// by the interpreter, replacing the module with the same name if enabled.
+// Functions of modules enabled later take precedence over those with the
+// same name in earlier ones.
+func (in *Interpreter) EnableModule(m *Module) {
+	in.DisableModule(m.Name)
+	in.modules = append(in.modules, m)
+}
+
+func (in *Interpreter) DisableModule(name string) {
+	for i, m := range in.modules {
+		if m.Name == name {
+			in.modules = append(in.modules[:i:i], in.modules[i+1:]...)
+			return
+		}
+	}
+}
+
+// Modules returns the names of the enabled modules, in the order they were
+// enabled.
+func (in *Interpreter) Modules() []string {
+	var names []string
+	for _, m := range in.modules {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Builtin returns the enabled function with the given name.
+func (in *Interpreter) Builtin(name string) (*object.Builtin, bool) {
+	for i := len(in.modules) - 1; i >= 0; i-- {
+		if builtin, ok := in.modules[i].Builtins[name]; ok {
+			return builtin, true
+		}
+	}
+	return nil, false
+}
+
+func (in *Interpreter) BuiltinNames() []string {
+	builtins := make(map[string]*object.Builtin)
+	for _, m := range in.modules {
+		for name, builtin := range m.Builtins {
+			builtins[name] = builtin
+		}
+	}
+	return sortedNames(builtins)
+}
+
+func sortedNames(builtins map[string]*object.Builtin) []string {
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
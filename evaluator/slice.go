@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"strings"
+)
+
+// normalizeIndex resolves a negative index, which counts from the end of a
+// sequence of the given length, and reports whether it is within bounds.
+func normalizeIndex(idx int64, length int64) (int64, bool) {
+	if idx < 0 {
+		idx += length
+	}
+	return idx, idx >= 0 && idx < length
+}
+
+// sliceBounds resolves the bounds of a slice of a sequence of the given
+// length as Python does: omitted bounds cover the whole sequence in the
+// direction of the step, negative ones count from the end, and out of range
+// ones are clamped, so that slicing never fails on bounds. A negative step
+// walks the sequence backwards from start, down to but excluding end.
+func sliceBounds(start, end, step object.Object, length int64) (int64, int64, int64, *object.Error) {
+	s := int64(1)
+	if step != nil {
+		s = step.(*object.Integer).Value
+		if s == 0 {
+			return 0, 0, 0, newError("slice step cannot be zero")
+		}
+	}
+
+	lower, upper := int64(0), length
+	if s < 0 {
+		lower, upper = -1, length-1
+	}
+
+	bound := func(b object.Object, omitted int64) int64 {
+		if b == nil {
+			return omitted
+		}
+
+		i := b.(*object.Integer).Value
+		if i < 0 {
+			i += length
+		}
+
+		return min(max(i, lower), upper)
+	}
+
+	if s < 0 {
+		return bound(start, upper), bound(end, lower), s, nil
+	}
+	return bound(start, lower), bound(end, upper), s, nil
+}
+
+// sliceIndices returns the indices selected by the resolved bounds of a
+// slice. They are counted up front, as stepping past end could overflow.
+func sliceIndices(start, end, step int64) []int64 {
+	n := rangeLength(start, end, step)
+	indices := make([]int64, n)
+
+	for k := range indices {
+		indices[k] = start + int64(k)*step
+	}
+
+	return indices
+}
+
+func evalSliceExpression(left object.Object, start, end, step object.Object) object.Object {
+	for _, b := range []object.Object{start, end, step} {
+		if b != nil && b.Type() != object.INTEGER {
+			return newError("invalid slice index type: %s", b.Type())
+		}
+	}
+
+	switch l := left.(type) {
+	case *object.Array:
+		first, last, s, err := sliceBounds(start, end, step, int64(len(l.Elements)))
+		if err != nil {
+			return err
+		}
+
+		elements := []object.Object{}
+		for _, i := range sliceIndices(first, last, s) {
+			elements = append(elements, l.Elements[i])
+		}
+
+		return &object.Array{Elements: elements}
+	case *object.String:
+		first, last, s, err := sliceBounds(start, end, step, int64(l.Len()))
+		if err != nil {
+			return err
+		}
+
+		if s == 1 {
+			return newStringObject(l.Substring(int(first), int(max(first, last))))
+		}
+
+		var out strings.Builder
+		for _, i := range sliceIndices(first, last, s) {
+			out.WriteString(l.Substring(int(i), int(i)+1))
+		}
+
+		return newStringObject(out.String())
+	default:
+		return newError("could not slice %s", left.Type())
+	}
+}
@@ -0,0 +1,139 @@
+package evaluator
+
+import (
+	"example.com/writing-an-interpreter/object"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringArguments checks that args are n strings, as taken by most of the
+// functions of the strings module.
+func stringArguments(name string, n int, args []object.Object) ([]string, *object.Error) {
+	if len(args) != n {
+		return nil, newArgumentNumberError(n, len(args), false)
+	}
+
+	values := make([]string, n)
+
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, newInvalidArgumentError(name, arg)
+		}
+		values[i] = s.Value
+	}
+
+	return values, nil
+}
+
+func builtinSplit(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	values, err := stringArguments("split", 2, args)
+	if err != nil {
+		return err
+	}
+
+	n := strings.Count(values[0], values[1]) + 1
+	if values[1] == "" {
+		n = utf8.RuneCountInString(values[0])
+	}
+	if err := ctx.Reserve(arraySize(n) + stringSize(0)*int64(n) + int64(len(values[0]))); err != nil {
+		return err
+	}
+
+	parts := strings.Split(values[0], values[1])
+	elements := make([]object.Object, len(parts))
+
+	for i, part := range parts {
+		elements[i] = newStringObject(part)
+	}
+
+	return allocated(ctx, &object.Array{Elements: elements})
+}
+
+func builtinJoin(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newArgumentNumberError(2, len(args), false)
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newInvalidArgumentError("join", args[0])
+	}
+
+	separator, ok := args[1].(*object.String)
+	if !ok {
+		return newInvalidArgumentError("join", args[1])
+	}
+
+	parts := make([]string, len(array.Elements))
+	n := 0
+
+	for i, e := range array.Elements {
+		s, ok := e.(*object.String)
+		if !ok {
+			return newInvalidArgumentError("join", e)
+		}
+		parts[i] = s.Value
+		n += len(s.Value)
+	}
+
+	if len(parts) > 1 {
+		n += len(separator.Value) * (len(parts) - 1)
+	}
+	if err := ctx.Reserve(stringSize(n)); err != nil {
+		return err
+	}
+
+	return allocated(ctx, newStringObject(strings.Join(parts, separator.Value)))
+}
+
+func builtinUpper(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	return mapString(ctx, "upper", args, strings.ToUpper)
+}
+
+func builtinLower(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	return mapString(ctx, "lower", args, strings.ToLower)
+}
+
+func builtinTrim(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	return mapString(ctx, "trim", args, strings.TrimSpace)
+}
+
+// mapString returns f applied to the only argument, a string, reserving
+// about as many bytes as the argument takes for the result.
+func mapString(ctx *object.BuiltinContext, name string, args []object.Object, f func(string) string) object.Object {
+	values, err := stringArguments(name, 1, args)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Reserve(stringSize(len(values[0]))); err != nil {
+		return err
+	}
+	return allocated(ctx, newStringObject(f(values[0])))
+}
+
+func builtinContains(args ...object.Object) object.Object {
+	values, err := stringArguments("contains", 2, args)
+	if err != nil {
+		return err
+	}
+	return newBooleanObject(strings.Contains(values[0], values[1]))
+}
+
+func builtinReplace(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	values, err := stringArguments("replace", 3, args)
+	if err != nil {
+		return err
+	}
+
+	s, old, replacement := values[0], values[1], values[2]
+
+	// Count matches an empty old string before every rune and at the end,
+	// wherever ReplaceAll inserts the replacement.
+	n := int64(strings.Count(s, old))
+	if err := ctx.Reserve(stringSize(len(s)) + n*(int64(len(replacement))-int64(len(old)))); err != nil {
+		return err
+	}
+
+	return allocated(ctx, newStringObject(strings.ReplaceAll(s, old, replacement)))
+}
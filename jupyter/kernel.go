@@ -0,0 +1,653 @@
+package jupyter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/diagnostic"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+	"hash"
+	"net"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const delimiter = "<IDS|MSG>"
+
+// Kernel runs the cells of Jupyter notebooks in one environment, kept
+// across cells.
+type Kernel struct {
+	// Interpreter evaluates the cells. Like the REPL, it is granted every
+	// capability.
+	Interpreter *evaluator.Interpreter
+
+	info           ConnectionInfo
+	env            *object.Environment
+	session        string
+	executionCount int
+
+	listeners []net.Listener
+	// requests are the messages received on the shell and control
+	// sockets, handled one at a time.
+	requests chan request
+	done     chan struct{}
+	closing  sync.Once
+
+	mu sync.Mutex
+	// conns are the connections of the clients, of which subscribers are
+	// those to the IOPub socket.
+	conns       map[*zmtpConn]bool
+	subscribers map[*zmtpConn]bool
+	// cancel stops the cell being executed, if any.
+	cancel context.CancelFunc
+}
+
+type request struct {
+	conn *zmtpConn
+	msg  *message
+}
+
+// Listen binds the sockets of a kernel to the ports of info, or to ports
+// chosen by the system for those that are 0. The cells executed are granted
+// capabilities.
+func Listen(info ConnectionInfo, capabilities object.Capability) (*Kernel, error) {
+	if info.Transport != "" && info.Transport != "tcp" {
+		return nil, fmt.Errorf("unsupported transport %s", info.Transport)
+	}
+	if info.SignatureScheme != "" && info.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("unsupported signature scheme %s", info.SignatureScheme)
+	}
+
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Capabilities = capabilities
+
+	k := &Kernel{
+		Interpreter: interpreter,
+		info:        info,
+		env:         object.NewEnvironment(),
+		session:     newID(),
+		requests:    make(chan request),
+		done:        make(chan struct{}),
+		conns:       make(map[*zmtpConn]bool),
+		subscribers: make(map[*zmtpConn]bool),
+	}
+
+	for _, socket := range []struct {
+		port  *int
+		serve func(*zmtpConn)
+		kind  string
+	}{
+		{&k.info.ShellPort, k.serveRequests, "ROUTER"},
+		{&k.info.ControlPort, k.serveRequests, "ROUTER"},
+		{&k.info.IOPubPort, k.serveSubscriber, "PUB"},
+		{&k.info.StdinPort, k.discard, "ROUTER"},
+		{&k.info.HBPort, k.serveHeartbeat, "REP"},
+	} {
+		listener, err := net.Listen("tcp", net.JoinHostPort(info.IP, strconv.Itoa(*socket.port)))
+		if err != nil {
+			_ = k.Close()
+			return nil, err
+		}
+
+		*socket.port = listener.Addr().(*net.TCPAddr).Port
+		k.listeners = append(k.listeners, listener)
+
+		go k.accept(listener, socket.kind, socket.serve)
+	}
+
+	return k, nil
+}
+
+// Info returns the connection information of the kernel, with the ports
+// it is bound to.
+func (k *Kernel) Info() ConnectionInfo {
+	return k.info
+}
+
+// Close stops the kernel, closing its sockets and connections.
+func (k *Kernel) Close() error {
+	var err error
+
+	k.closing.Do(func() {
+		close(k.done)
+
+		for _, listener := range k.listeners {
+			if closeErr := listener.Close(); err == nil {
+				err = closeErr
+			}
+		}
+
+		k.mu.Lock()
+		for conn := range k.conns {
+			_ = conn.Close()
+		}
+		k.mu.Unlock()
+	})
+
+	return err
+}
+
+// Serve handles the requests of the clients until one of them asks the
+// kernel to shut down, or it is closed.
+func (k *Kernel) Serve() error {
+	defer func() {
+		_ = k.Close()
+	}()
+
+	for {
+		select {
+		case <-k.done:
+			return nil
+		case req := <-k.requests:
+			shutdown, err := k.handle(req)
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if shutdown {
+				return nil
+			}
+		}
+	}
+}
+
+func (k *Kernel) accept(listener net.Listener, socketType string, serve func(*zmtpConn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			c, err := handshake(conn, socketType)
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+
+			k.mu.Lock()
+			k.conns[c] = true
+			k.mu.Unlock()
+
+			serve(c)
+
+			k.mu.Lock()
+			delete(k.conns, c)
+			k.mu.Unlock()
+			_ = c.Close()
+		}()
+	}
+}
+
+// serveRequests passes the messages received on conn to Serve, except
+// interrupt requests, which are answered at once to stop the cell being
+// executed.
+func (k *Kernel) serveRequests(conn *zmtpConn) {
+	for {
+		frames, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+
+		msg, err := k.decode(frames)
+		if err != nil {
+			// Messages that are malformed or badly signed are dropped.
+			continue
+		}
+
+		if msg.Header.MsgType == "interrupt_request" {
+			k.interrupt()
+			if k.reply(conn, msg, map[string]string{"status": "ok"}) != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case k.requests <- request{conn: conn, msg: msg}:
+		case <-k.done:
+			return
+		}
+	}
+}
+
+func (k *Kernel) serveSubscriber(conn *zmtpConn) {
+	k.mu.Lock()
+	k.subscribers[conn] = true
+	k.mu.Unlock()
+
+	// Subscriptions are ignored, every message is published.
+	k.discard(conn)
+
+	k.mu.Lock()
+	delete(k.subscribers, conn)
+	k.mu.Unlock()
+}
+
+func (k *Kernel) serveHeartbeat(conn *zmtpConn) {
+	for {
+		frames, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.writeMessage(frames); err != nil {
+			return
+		}
+	}
+}
+
+func (k *Kernel) discard(conn *zmtpConn) {
+	for {
+		if _, err := conn.readMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (k *Kernel) interrupt() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.cancel != nil {
+		k.cancel()
+	}
+}
+
+func (k *Kernel) signature() hash.Hash {
+	if k.info.Key == "" {
+		return nil
+	}
+	return hmac.New(sha256.New, []byte(k.info.Key))
+}
+
+// decode reads a message from its frames, checking its signature.
+func (k *Kernel) decode(frames [][]byte) (*message, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != delimiter {
+		i++
+	}
+
+	if len(frames) < i+6 {
+		return nil, errors.New("malformed message")
+	}
+
+	parts := frames[i+2 : i+6]
+
+	if mac := k.signature(); mac != nil {
+		for _, part := range parts {
+			mac.Write(part)
+		}
+
+		signature, err := hex.DecodeString(string(frames[i+1]))
+		if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+
+	msg := &message{
+		identities:   frames[:i],
+		ParentHeader: parts[1],
+		Metadata:     parts[2],
+		Content:      parts[3],
+	}
+
+	if err := json.Unmarshal(parts[0], &msg.Header); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// send writes a message of the given type and content to conn, in reply to
+// parent if not nil.
+func (k *Kernel) send(conn *zmtpConn, identities [][]byte, msgType string, parent *message, content any) error {
+	header, err := json.Marshal(Header{
+		MsgID:    newID(),
+		Session:  k.session,
+		Username: "kernel",
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  msgType,
+		Version:  protocolVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	parentHeader := []byte("{}")
+	if parent != nil {
+		if parentHeader, err = json.Marshal(parent.Header); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	parts := [][]byte{header, parentHeader, []byte("{}"), body}
+
+	var signature string
+	if mac := k.signature(); mac != nil {
+		for _, part := range parts {
+			mac.Write(part)
+		}
+		signature = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	frames := append(identities[:len(identities):len(identities)], []byte(delimiter), []byte(signature))
+	return conn.writeMessage(append(frames, parts...))
+}
+
+func (k *Kernel) reply(conn *zmtpConn, req *message, content any) error {
+	msgType := strings.TrimSuffix(req.Header.MsgType, "_request") + "_reply"
+	return k.send(conn, req.identities, msgType, req, content)
+}
+
+// publish sends a message to every subscriber of the IOPub socket.
+func (k *Kernel) publish(msgType string, parent *message, content any) {
+	k.mu.Lock()
+	subscribers := make([]*zmtpConn, 0, len(k.subscribers))
+	for conn := range k.subscribers {
+		subscribers = append(subscribers, conn)
+	}
+	k.mu.Unlock()
+
+	for _, conn := range subscribers {
+		// A subscriber that cannot be written to is dropped once its
+		// connection is closed.
+		_ = k.send(conn, [][]byte{[]byte(msgType)}, msgType, parent, content)
+	}
+}
+
+// handle answers a request, reporting whether the kernel should shut down.
+func (k *Kernel) handle(req request) (bool, error) {
+	msg := req.msg
+
+	k.publish("status", msg, map[string]string{"execution_state": "busy"})
+	defer k.publish("status", msg, map[string]string{"execution_state": "idle"})
+
+	var content any
+	var err error
+
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		content = k.kernelInfo()
+	case "execute_request":
+		content, err = decodeContent(msg, k.execute)
+	case "complete_request":
+		content, err = decodeContent(msg, k.complete)
+	case "inspect_request":
+		content, err = decodeContent(msg, k.inspect)
+	case "is_complete_request":
+		content, err = decodeContent(msg, isComplete)
+	case "comm_info_request":
+		content = map[string]any{"status": "ok", "comms": map[string]any{}}
+	case "history_request":
+		content = map[string]any{"status": "ok", "history": []any{}}
+	case "shutdown_request":
+		var shutdown ShutdownRequest
+		if err := json.Unmarshal(msg.Content, &shutdown); err != nil {
+			return false, nil
+		}
+		return true, k.reply(req.conn, msg, ShutdownReply{Status: "ok", Restart: shutdown.Restart})
+	default:
+		return false, nil
+	}
+
+	if err != nil {
+		// Requests whose content cannot be decoded are not answered.
+		return false, nil
+	}
+
+	return false, k.reply(req.conn, msg, content)
+}
+
+func decodeContent[T any, R any](msg *message, handle func(*message, T) R) (R, error) {
+	var content T
+	if err := json.Unmarshal(msg.Content, &content); err != nil {
+		var zero R
+		return zero, err
+	}
+	return handle(msg, content), nil
+}
+
+func (k *Kernel) kernelInfo() KernelInfoReply {
+	version := "devel"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+
+	return KernelInfoReply{
+		Status:                "ok",
+		ProtocolVersion:       protocolVersion,
+		Implementation:        "mandrill",
+		ImplementationVersion: version,
+		LanguageInfo: LanguageInfo{
+			Name:          "mandrill",
+			Version:       version,
+			Mimetype:      "text/x-mandrill",
+			FileExtension: ".mnd",
+		},
+		Banner: "This is the Mandrill programming language.",
+	}
+}
+
+// execute evaluates the code of a cell, publishing what it prints, then its
+// result or error.
+func (k *Kernel) execute(msg *message, req ExecuteRequest) ExecuteReply {
+	if req.StoreHistory && !req.Silent {
+		k.executionCount++
+	}
+
+	reply := ExecuteReply{
+		Status:          "ok",
+		ExecutionCount:  k.executionCount,
+		UserExpressions: map[string]any{},
+		Payload:         []any{},
+	}
+
+	if !req.Silent {
+		k.publish("execute_input", msg, map[string]any{"code": req.Code, "execution_count": k.executionCount})
+	}
+
+	p := parser.NewParser(lexer.NewLexer(req.Code))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		return k.fail(msg, reply, "ParseError", req.Code, diagnostics)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k.mu.Lock()
+	k.cancel = cancel
+	k.mu.Unlock()
+
+	var out bytes.Buffer
+	k.Interpreter.Out = &out
+	k.Interpreter.Context = ctx
+
+	result, crash := k.evaluate(program)
+
+	k.mu.Lock()
+	k.cancel = nil
+	k.mu.Unlock()
+	cancel()
+
+	if out.Len() > 0 && !req.Silent {
+		k.publish("stream", msg, map[string]string{"name": "stdout", "text": out.String()})
+	}
+
+	if crash != nil {
+		return k.fail(msg, reply, "InternalError", req.Code, []diagnostic.Diagnostic{{
+			Severity: diagnostic.Error,
+			Code:     "internal-error",
+			Message:  fmt.Sprint(crash),
+		}})
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return k.fail(msg, reply, "RuntimeError", req.Code, []diagnostic.Diagnostic{evaluator.ErrorDiagnostic(err)})
+	}
+
+	if result != nil && result != evaluator.NULL && !req.Silent {
+		k.publish("execute_result", msg, ExecuteResult{
+			ExecutionCount: k.executionCount,
+			Data:           map[string]string{"text/plain": result.Inspect()},
+			Metadata:       map[string]any{},
+		})
+	}
+
+	return reply
+}
+
+// evaluate evaluates a cell, returning what the interpreter panicked with
+// instead of crashing the kernel if it does.
+func (k *Kernel) evaluate(program *ast.Program) (result object.Object, crash any) {
+	defer func() {
+		crash = recover()
+	}()
+
+	return k.Interpreter.Eval(program, k.env), nil
+}
+
+// fail publishes the errors of a cell, returning the reply reporting them.
+func (k *Kernel) fail(msg *message, reply ExecuteReply, name string, code string, diagnostics []diagnostic.Diagnostic) ExecuteReply {
+	var traceback strings.Builder
+	_ = diagnostic.WriteText(&traceback, "", code, diagnostics)
+
+	reply.Status = "error"
+	reply.ErrorContent = ErrorContent{
+		Ename:     name,
+		Evalue:    diagnostics[0].Message,
+		Traceback: strings.Split(strings.TrimSuffix(traceback.String(), "\n"), "\n"),
+	}
+
+	k.publish("error", msg, reply.ErrorContent)
+	return reply
+}
+
+func (k *Kernel) complete(_ *message, req CompleteRequest) CompleteReply {
+	code := []rune(req.Code)
+	end := min(max(req.CursorPos, 0), len(code))
+	start := end
+
+	for start > 0 && isIdentifierRune(code[start-1]) {
+		start--
+	}
+
+	reply := CompleteReply{Status: "ok", Matches: []string{}, CursorStart: start, CursorEnd: end, Metadata: map[string]any{}}
+
+	prefix := string(code[start:end])
+	if prefix == "" {
+		return reply
+	}
+
+	names := append(token.Keywords(), k.Interpreter.BuiltinNames()...)
+	for name := range k.env.Bindings() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if strings.HasPrefix(name, prefix) && (i == 0 || names[i-1] != name) {
+			reply.Matches = append(reply.Matches, name)
+		}
+	}
+
+	return reply
+}
+
+// inspect describes the identifier under the cursor.
+func (k *Kernel) inspect(_ *message, req InspectRequest) InspectReply {
+	code := []rune(req.Code)
+	start := min(max(req.CursorPos, 0), len(code))
+	end := start
+
+	for start > 0 && isIdentifierRune(code[start-1]) {
+		start--
+	}
+	for end < len(code) && isIdentifierRune(code[end]) {
+		end++
+	}
+
+	reply := InspectReply{Status: "ok", Data: map[string]string{}, Metadata: map[string]any{}}
+	name := string(code[start:end])
+
+	var text string
+
+	if value, ok := k.env.Get(name); ok {
+		text = fmt.Sprintf("%s: %s\n%s", name, value.Type(), value.Inspect())
+	} else if _, ok := k.Interpreter.Builtin(name); ok {
+		text = name + ": built-in function"
+	} else if name != "" && token.LookupIdent(name) != token.IDENT {
+		text = name + ": keyword"
+	} else {
+		return reply
+	}
+
+	reply.Found = true
+	reply.Data["text/plain"] = text
+	return reply
+}
+
+// isComplete tells whether code can be executed, or needs more lines: it is
+// incomplete if brackets are left open, or if its only errors are at its
+// end.
+func isComplete(_ *message, req IsCompleteRequest) IsCompleteReply {
+	l := lexer.NewLexer(req.Code)
+	depth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+
+	if depth > 0 {
+		return IsCompleteReply{Status: "incomplete"}
+	}
+
+	p := parser.NewParser(lexer.NewLexer(req.Code))
+	p.ParseProgram()
+
+	end := len(strings.TrimRightFunc(req.Code, unicode.IsSpace))
+	status := "complete"
+
+	for _, d := range p.Diagnostics() {
+		if d.Range.Start.Offset < end && d.Code != diagnostic.UnterminatedString {
+			return IsCompleteReply{Status: "invalid"}
+		}
+		status = "incomplete"
+	}
+
+	return IsCompleteReply{Status: status}
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
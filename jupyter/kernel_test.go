@@ -0,0 +1,419 @@
+package jupyter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/object"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testKey = "secret"
+
+type client struct {
+	t     *testing.T
+	shell *zmtpConn
+	iopub *zmtpConn
+}
+
+// startKernel starts a kernel granted environment variable access, after
+// passing it to setup if not nil, and connects a client to it.
+func startKernel(t *testing.T, setup func(*Kernel)) (*Kernel, *client, chan error) {
+	t.Helper()
+
+	k, err := Listen(ConnectionInfo{Transport: "tcp", IP: "127.0.0.1", Key: testKey, SignatureScheme: "hmac-sha256"}, object.EnvironmentVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(k)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- k.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = k.Close()
+	})
+
+	c := &client{
+		t:     t,
+		shell: dial(t, k.Info().ShellPort, "DEALER"),
+		iopub: dial(t, k.Info().IOPubPort, "SUB"),
+	}
+
+	if err := c.iopub.writeMessage([][]byte{{1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the subscriber to be registered, not to miss messages.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		k.mu.Lock()
+		subscribed := len(k.subscribers) > 0
+		k.mu.Unlock()
+
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return k, c, done
+}
+
+func dial(t *testing.T, port int, socketType string) *zmtpConn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := handshake(conn, socketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+
+	return c
+}
+
+func sign(key string, parts [][]byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *client) request(key string, msgType string, content any) {
+	c.t.Helper()
+
+	header, _ := json.Marshal(Header{MsgID: msgType + "-id", Session: "client", MsgType: msgType, Version: protocolVersion})
+	body, _ := json.Marshal(content)
+	parts := [][]byte{header, []byte("{}"), []byte("{}"), body}
+
+	frames := append([][]byte{[]byte(delimiter), []byte(sign(key, parts))}, parts...)
+	if err := c.shell.writeMessage(frames); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads a message from conn, checking its signature and that it
+// answers a request of the given type.
+func (c *client) receive(conn *zmtpConn, requestType string) (string, map[string]any) {
+	c.t.Helper()
+
+	frames, err := conn.readMessage()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	i := 0
+	for string(frames[i]) != delimiter {
+		i++
+	}
+
+	parts := frames[i+2 : i+6]
+	if string(frames[i+1]) != sign(testKey, parts) {
+		c.t.Fatalf("wrong signature %s", frames[i+1])
+	}
+
+	var header, parent Header
+	var content map[string]any
+
+	for j, v := range []any{&header, &parent, &content} {
+		if err := json.Unmarshal(parts[[]int{0, 1, 3}[j]], v); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	if parent.MsgType != requestType {
+		c.t.Fatalf("%s answers %q, expected %q", header.MsgType, parent.MsgType, requestType)
+	}
+
+	return header.MsgType, content
+}
+
+// published reads the messages published for a request until the kernel is
+// idle again, leaving out the status messages.
+func (c *client) published(requestType string) map[string]map[string]any {
+	c.t.Helper()
+
+	if msgType, content := c.receive(c.iopub, requestType); msgType != "status" || content["execution_state"] != "busy" {
+		c.t.Fatalf("expected busy status, got %s %v", msgType, content)
+	}
+
+	messages := make(map[string]map[string]any)
+
+	for {
+		msgType, content := c.receive(c.iopub, requestType)
+		if msgType == "status" {
+			return messages
+		}
+		messages[msgType] = content
+	}
+}
+
+func TestKernelInfo(t *testing.T) {
+	_, c, _ := startKernel(t, nil)
+
+	c.request(testKey, "kernel_info_request", map[string]any{})
+
+	msgType, reply := c.receive(c.shell, "kernel_info_request")
+	if msgType != "kernel_info_reply" || reply["protocol_version"] != protocolVersion {
+		t.Fatalf("wrong reply %s %v", msgType, reply)
+	}
+	if info := reply["language_info"].(map[string]any); info["name"] != "mandrill" || info["file_extension"] != ".mnd" {
+		t.Errorf("wrong language info %v", info)
+	}
+
+	c.published("kernel_info_request")
+}
+
+func TestExecute(t *testing.T) {
+	_, c, _ := startKernel(t, nil)
+
+	tests := []struct {
+		code      string
+		reply     map[string]any
+		published map[string]map[string]any
+	}{
+		{
+			`let x = 2; print("hi"); x * 21`,
+			map[string]any{"status": "ok", "execution_count": 1.0, "user_expressions": map[string]any{}, "payload": []any{}},
+			map[string]map[string]any{
+				"execute_input":  {"code": `let x = 2; print("hi"); x * 21`, "execution_count": 1.0},
+				"stream":         {"name": "stdout", "text": "hi\n"},
+				"execute_result": {"execution_count": 1.0, "data": map[string]any{"text/plain": "42"}, "metadata": map[string]any{}},
+			},
+		},
+		{
+			"let y = x; y",
+			map[string]any{"status": "ok", "execution_count": 2.0, "user_expressions": map[string]any{}, "payload": []any{}},
+			map[string]map[string]any{
+				"execute_input":  {"code": "let y = x; y", "execution_count": 2.0},
+				"execute_result": {"execution_count": 2.0, "data": map[string]any{"text/plain": "2"}, "metadata": map[string]any{}},
+			},
+		},
+		{
+			"x + true",
+			map[string]any{
+				"status": "error", "execution_count": 3.0, "user_expressions": map[string]any{}, "payload": []any{},
+				"ename": "RuntimeError", "evalue": "type mismatch: INTEGER + BOOLEAN",
+				"traceback": []any{"1:3: error[runtime-error]: type mismatch: INTEGER + BOOLEAN", "    x + true", "      ^"},
+			},
+			map[string]map[string]any{
+				"execute_input": {"code": "x + true", "execution_count": 3.0},
+				"error": {
+					"ename": "RuntimeError", "evalue": "type mismatch: INTEGER + BOOLEAN",
+					"traceback": []any{"1:3: error[runtime-error]: type mismatch: INTEGER + BOOLEAN", "    x + true", "      ^"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.request(testKey, "execute_request", map[string]any{"code": tt.code, "silent": false, "store_history": true})
+
+		published := c.published("execute_request")
+		if !reflect.DeepEqual(published, tt.published) {
+			t.Errorf("wrong messages published for %q.\nexpected=%v\ngot=%v", tt.code, tt.published, published)
+		}
+
+		_, reply := c.receive(c.shell, "execute_request")
+		if !reflect.DeepEqual(reply, tt.reply) {
+			t.Errorf("wrong reply for %q.\nexpected=%v\ngot=%v", tt.code, tt.reply, reply)
+		}
+	}
+
+	c.request(testKey, "execute_request", map[string]any{"code": "let = 1", "silent": false, "store_history": true})
+	if published := c.published("execute_request"); published["error"]["ename"] != "ParseError" {
+		t.Errorf("parse error not published. got=%v", published)
+	}
+	if _, reply := c.receive(c.shell, "execute_request"); reply["status"] != "error" || reply["ename"] != "ParseError" {
+		t.Errorf("wrong reply for a parse error. got=%v", reply)
+	}
+}
+
+func TestExecuteCapabilities(t *testing.T) {
+	_, c, _ := startKernel(t, nil)
+
+	tests := []struct {
+		code   string
+		status string
+	}{
+		{`getenv("HOME")`, "ok"},
+		{`now()`, "error"},
+	}
+
+	for _, tt := range tests {
+		c.request(testKey, "execute_request", map[string]any{"code": tt.code, "silent": false, "store_history": true})
+		c.published("execute_request")
+
+		if _, reply := c.receive(c.shell, "execute_request"); reply["status"] != tt.status {
+			t.Errorf("wrong status for %q. expected=%s, got=%v", tt.code, tt.status, reply)
+		}
+	}
+}
+
+func TestExecutePanic(t *testing.T) {
+	_, c, _ := startKernel(t, func(k *Kernel) {
+		k.Interpreter.EnableModule(&evaluator.Module{Name: "crash", Builtins: map[string]*object.Builtin{
+			"crash": {Fn: func(_ *object.BuiltinContext, _ ...object.Object) object.Object { panic("crashed") }},
+		}})
+	})
+
+	c.request(testKey, "execute_request", map[string]any{"code": "crash()", "silent": false, "store_history": true})
+	if published := c.published("execute_request"); published["error"]["evalue"] != "crashed" {
+		t.Errorf("panic not published. got=%v", published)
+	}
+	if _, reply := c.receive(c.shell, "execute_request"); reply["status"] != "error" || reply["ename"] != "InternalError" {
+		t.Errorf("wrong reply for a panic. got=%v", reply)
+	}
+
+	// The kernel goes on executing cells.
+	c.request(testKey, "execute_request", map[string]any{"code": "1 + 2", "silent": false, "store_history": true})
+	if published := c.published("execute_request"); published["execute_result"]["data"].(map[string]any)["text/plain"] != "3" {
+		t.Errorf("wrong result after a panic. got=%v", published)
+	}
+	c.receive(c.shell, "execute_request")
+}
+
+func TestFrameSizeLimit(t *testing.T) {
+	frame := binary.BigEndian.AppendUint64([]byte{flagLong}, 1<<62)
+	c := &zmtpConn{in: bufio.NewReader(bytes.NewReader(frame))}
+
+	if _, _, err := c.readFrame(); err == nil {
+		t.Errorf("expected an error reading a frame over the limit")
+	}
+}
+
+func TestMessageLimits(t *testing.T) {
+	large := binary.BigEndian.AppendUint64([]byte{flagMore | flagLong}, maxFrameSize)
+	large = append(large, make([]byte, maxFrameSize)...)
+
+	tests := []struct {
+		frame    []byte
+		expected string
+	}{
+		{[]byte{flagMore, 1, 'x'}, "zmtp: message exceeds the limit of 1024 frames"},
+		{large, "zmtp: message exceeds the limit of 16777216 bytes"},
+	}
+
+	for _, tt := range tests {
+		// The peer sends frames of the same message without end.
+		c := &zmtpConn{in: bufio.NewReader(&repeatReader{data: tt.frame})}
+
+		_, err := c.readMessage()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// repeatReader reads data over and over.
+type repeatReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.offset:])
+	r.offset = (r.offset + n) % len(r.data)
+	return n, nil
+}
+
+func TestCompleteAndInspect(t *testing.T) {
+	_, c, _ := startKernel(t, nil)
+
+	c.request(testKey, "execute_request", map[string]any{"code": "let lasting = [1]", "silent": true, "store_history": false})
+	c.published("execute_request")
+	c.receive(c.shell, "execute_request")
+
+	tests := []struct {
+		msgType  string
+		content  map[string]any
+		expected map[string]any
+	}{
+		{"complete_request", map[string]any{"code": "1 + las", "cursor_pos": 7}, map[string]any{
+			"status": "ok", "matches": []any{"last", "lasting"}, "cursor_start": 4.0, "cursor_end": 7.0, "metadata": map[string]any{},
+		}},
+		{"complete_request", map[string]any{"code": "é + re)", "cursor_pos": 6}, map[string]any{
+			"status": "ok", "matches": []any{"read_file", "reduce", "replace", "return"}, "cursor_start": 4.0, "cursor_end": 6.0, "metadata": map[string]any{},
+		}},
+		{"inspect_request", map[string]any{"code": "len(lasting)", "cursor_pos": 6, "detail_level": 0}, map[string]any{
+			"status": "ok", "found": true, "data": map[string]any{"text/plain": "lasting: ARRAY\n[1]"}, "metadata": map[string]any{},
+		}},
+		{"inspect_request", map[string]any{"code": "len(lasting)", "cursor_pos": 1, "detail_level": 0}, map[string]any{
+			"status": "ok", "found": true, "data": map[string]any{"text/plain": "len: built-in function"}, "metadata": map[string]any{},
+		}},
+		{"inspect_request", map[string]any{"code": "nothing", "cursor_pos": 1, "detail_level": 0}, map[string]any{
+			"status": "ok", "found": false, "data": map[string]any{}, "metadata": map[string]any{},
+		}},
+		{"is_complete_request", map[string]any{"code": "let f = fn(x) {"}, map[string]any{"status": "incomplete"}},
+		{"is_complete_request", map[string]any{"code": "let = 1; 2"}, map[string]any{"status": "invalid"}},
+		{"is_complete_request", map[string]any{"code": "1 + 2"}, map[string]any{"status": "complete"}},
+	}
+
+	for _, tt := range tests {
+		c.request(testKey, tt.msgType, tt.content)
+		c.published(tt.msgType)
+
+		_, reply := c.receive(c.shell, tt.msgType)
+		if !reflect.DeepEqual(reply, tt.expected) {
+			t.Errorf("wrong reply for %s %v.\nexpected=%v\ngot=%v", tt.msgType, tt.content, tt.expected, reply)
+		}
+	}
+}
+
+func TestHeartbeatAndShutdown(t *testing.T) {
+	k, c, done := startKernel(t, nil)
+
+	hb := dial(t, k.Info().HBPort, "REQ")
+	ping := [][]byte{{}, []byte("ping")}
+	if err := hb.writeMessage(ping); err != nil {
+		t.Fatal(err)
+	}
+	if pong, err := hb.readMessage(); err != nil || !reflect.DeepEqual(pong, ping) {
+		t.Errorf("heartbeat not echoed. got=%q, %v", pong, err)
+	}
+
+	// Messages with a wrong signature are dropped.
+	c.request("wrong", "shutdown_request", map[string]any{"restart": false})
+	c.request(testKey, "kernel_info_request", map[string]any{})
+	c.published("kernel_info_request")
+	c.receive(c.shell, "kernel_info_request")
+
+	c.request(testKey, "shutdown_request", map[string]any{"restart": true})
+	if msgType, reply := c.receive(c.shell, "shutdown_request"); msgType != "shutdown_reply" || reply["restart"] != true {
+		t.Errorf("wrong shutdown reply %s %v", msgType, reply)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("kernel did not shut down")
+	}
+}
@@ -0,0 +1,124 @@
+package jupyter
+
+import "encoding/json"
+
+const protocolVersion = "5.3"
+
+// ConnectionInfo is the content of the connection file Jupyter passes to
+// the kernels it starts.
+type ConnectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	StdinPort       int    `json:"stdin_port"`
+	ControlPort     int    `json:"control_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+}
+
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// message is a message of the Jupyter messaging protocol.
+type message struct {
+	// identities are the frames preceding the delimiter, which replies
+	// are sent back with.
+	identities   [][]byte
+	Header       Header
+	ParentHeader json.RawMessage
+	Metadata     json.RawMessage
+	Content      json.RawMessage
+}
+
+type ExecuteRequest struct {
+	Code         string `json:"code"`
+	Silent       bool   `json:"silent"`
+	StoreHistory bool   `json:"store_history"`
+}
+
+type ExecuteReply struct {
+	Status          string         `json:"status"`
+	ExecutionCount  int            `json:"execution_count"`
+	UserExpressions map[string]any `json:"user_expressions"`
+	Payload         []any          `json:"payload"`
+	ErrorContent
+}
+
+type ErrorContent struct {
+	Ename     string   `json:"ename,omitempty"`
+	Evalue    string   `json:"evalue,omitempty"`
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+type ExecuteResult struct {
+	ExecutionCount int               `json:"execution_count"`
+	Data           map[string]string `json:"data"`
+	Metadata       map[string]any    `json:"metadata"`
+}
+
+type CompleteRequest struct {
+	Code      string `json:"code"`
+	CursorPos int    `json:"cursor_pos"`
+}
+
+type CompleteReply struct {
+	Status      string         `json:"status"`
+	Matches     []string       `json:"matches"`
+	CursorStart int            `json:"cursor_start"`
+	CursorEnd   int            `json:"cursor_end"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+type InspectRequest struct {
+	Code        string `json:"code"`
+	CursorPos   int    `json:"cursor_pos"`
+	DetailLevel int    `json:"detail_level"`
+}
+
+type InspectReply struct {
+	Status   string            `json:"status"`
+	Found    bool              `json:"found"`
+	Data     map[string]string `json:"data"`
+	Metadata map[string]any    `json:"metadata"`
+}
+
+type KernelInfoReply struct {
+	Status                string       `json:"status"`
+	ProtocolVersion       string       `json:"protocol_version"`
+	Implementation        string       `json:"implementation"`
+	ImplementationVersion string       `json:"implementation_version"`
+	LanguageInfo          LanguageInfo `json:"language_info"`
+	Banner                string       `json:"banner"`
+}
+
+type LanguageInfo struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	Mimetype      string `json:"mimetype"`
+	FileExtension string `json:"file_extension"`
+}
+
+type IsCompleteRequest struct {
+	Code string `json:"code"`
+}
+
+type IsCompleteReply struct {
+	Status string `json:"status"`
+}
+
+type ShutdownRequest struct {
+	Restart bool `json:"restart"`
+}
+
+type ShutdownReply struct {
+	Status  string `json:"status"`
+	Restart bool   `json:"restart"`
+}
@@ -0,0 +1,234 @@
+package jupyter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// The sockets of a kernel speak ZMTP 3.0, the wire protocol of ZeroMQ, with
+// the NULL security mechanism. Only what Jupyter clients need is
+// implemented: a peer is served on the connection it came from, so ROUTER
+// sockets do not need routing ids, and messages are published to every
+// subscriber of a PUB socket regardless of its subscriptions.
+
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// maxFrameSize bounds the frames read, whose size is sent by the peer before
+// them, so that a peer cannot make the kernel allocate any amount of memory.
+const maxFrameSize = 8 << 20
+
+// maxMessageSize and maxMessageFrames bound the messages read in the same
+// way, whatever the size of their frames.
+const (
+	maxMessageSize   = 16 << 20
+	maxMessageFrames = 1024
+)
+
+// zmtpConn is a connection to a ZeroMQ peer, on which messages of several
+// frames are read and written.
+type zmtpConn struct {
+	conn net.Conn
+	in   *bufio.Reader
+	// mu serializes the messages written.
+	mu sync.Mutex
+}
+
+// greeting returns the greeting of a ZMTP 3.0 peer using the NULL
+// mechanism.
+func greeting() []byte {
+	g := make([]byte, 64)
+	g[0], g[9] = 0xff, 0x7f
+	g[10], g[11] = 3, 0
+	copy(g[12:32], "NULL")
+	return g
+}
+
+// handshake exchanges greetings and READY commands with the peer connected
+// to conn, announcing a socket of the given type.
+func handshake(conn net.Conn, socketType string) (*zmtpConn, error) {
+	c := &zmtpConn{conn: conn, in: bufio.NewReader(conn)}
+
+	if _, err := conn.Write(greeting()); err != nil {
+		return nil, err
+	}
+
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(c.in, peer); err != nil {
+		return nil, err
+	}
+
+	if peer[0] != 0xff || peer[9] != 0x7f || peer[10] < 3 {
+		return nil, errors.New("zmtp: peer does not speak ZMTP 3")
+	}
+	if mechanism := string(bytes.TrimRight(peer[12:32], "\x00")); mechanism != "NULL" {
+		return nil, fmt.Errorf("zmtp: unsupported security mechanism %s", mechanism)
+	}
+
+	if err := c.writeCommand("READY", readyProperties(socketType)); err != nil {
+		return nil, err
+	}
+
+	name, _, err := c.readCommand()
+	if err != nil {
+		return nil, err
+	}
+	if name != "READY" {
+		return nil, fmt.Errorf("zmtp: expected READY, got %s", name)
+	}
+
+	return c, nil
+}
+
+func readyProperties(socketType string) []byte {
+	var b bytes.Buffer
+
+	b.WriteByte(byte(len("Socket-Type")))
+	b.WriteString("Socket-Type")
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(socketType)))
+	b.WriteString(socketType)
+
+	return b.Bytes()
+}
+
+func (c *zmtpConn) readFrame() (flags byte, body []byte, err error) {
+	flags, err = c.in.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		err = binary.Read(c.in, binary.BigEndian, &size)
+	} else {
+		var short byte
+		short, err = c.in.ReadByte()
+		size = uint64(short)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("zmtp: frame of %d bytes exceeds the limit of %d", size, maxFrameSize)
+	}
+
+	body = make([]byte, size)
+	_, err = io.ReadFull(c.in, body)
+	return flags, body, err
+}
+
+func (c *zmtpConn) readCommand() (name string, data []byte, err error) {
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if flags&flagCommand == 0 || len(body) == 0 || int(body[0]) >= len(body) {
+		return "", nil, errors.New("zmtp: malformed command")
+	}
+
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+// readMessage reads the frames of the next message, answering the commands
+// received before it.
+func (c *zmtpConn) readMessage() ([][]byte, error) {
+	var frames [][]byte
+	size := 0
+
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		if flags&flagCommand != 0 {
+			if err := c.answer(body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		size += len(body)
+		if size > maxMessageSize {
+			return nil, fmt.Errorf("zmtp: message exceeds the limit of %d bytes", maxMessageSize)
+		}
+		if len(frames) == maxMessageFrames {
+			return nil, fmt.Errorf("zmtp: message exceeds the limit of %d frames", maxMessageFrames)
+		}
+		frames = append(frames, body)
+
+		if flags&flagMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+// answer replies to PING commands of ZMTP 3.1 peers, ignoring the others.
+func (c *zmtpConn) answer(command []byte) error {
+	if len(command) == 0 || int(command[0]) >= len(command) || string(command[1:1+command[0]]) != "PING" {
+		return nil
+	}
+
+	// The context of the PING follows its time to live.
+	data := command[1+command[0]:]
+	if len(data) >= 2 {
+		data = data[2:]
+	}
+
+	return c.writeCommand("PONG", data)
+}
+
+func (c *zmtpConn) writeCommand(name string, data []byte) error {
+	body := append([]byte{byte(len(name))}, name...)
+	body = append(body, data...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.writeFrame(flagCommand, body)
+}
+
+// writeMessage writes a message made of the given frames.
+func (c *zmtpConn) writeMessage(frames [][]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = flagMore
+		}
+		if err := c.writeFrame(flags, frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *zmtpConn) writeFrame(flags byte, body []byte) error {
+	var header []byte
+
+	if len(body) > 255 {
+		header = binary.BigEndian.AppendUint64([]byte{flags | flagLong}, uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+
+	_, err := c.conn.Write(append(header, body...))
+	return err
+}
+
+func (c *zmtpConn) Close() error {
+	return c.conn.Close()
+}
@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"example.com/writing-an-interpreter/diagnostic"
 	"example.com/writing-an-interpreter/token"
+	"fmt"
 )
 
 type Lexer struct {
@@ -9,15 +11,23 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current character)
 	ch           byte // current character under examination
+	line         int  // line of the current character, starting at 1
+	lineStart    int  // position of the first character of the current line
+	diagnostics  []diagnostic.Diagnostic
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -31,6 +41,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	position := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -40,6 +51,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = "=="
 		} else {
 			tok = newToken(token.ASSIGN, '=')
+			tok.Position = position
 			return tok
 		}
 	case ';':
@@ -61,6 +73,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = "!="
 		} else {
 			tok = newToken(token.BANG, '!')
+			tok.Position = position
 			return tok
 		}
 	case '*':
@@ -84,6 +97,15 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Literal = l.readStringLiteral()
 		tok.Type = token.STRING
+
+		if l.ch == 0 {
+			tok.Position = position
+			l.report(diagnostic.UnterminatedString, "unterminated string literal", diagnostic.Range{
+				Start: position,
+				End:   l.currentPosition(),
+			})
+			return tok
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -91,20 +113,47 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Position = position
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT
+			tok.Position = position
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
+			tok.Position = position
+			l.report(diagnostic.IllegalCharacter, fmt.Sprintf("illegal character %q", l.ch), diagnostic.TokenRange(tok))
 		}
 	}
 
 	l.readChar()
+	tok.Position = position
 	return tok
 }
 
+// Diagnostics returns the problems found in the input read so far.
+func (l *Lexer) Diagnostics() []diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+func (l *Lexer) report(code string, message string, r diagnostic.Range) {
+	l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  message,
+		Range:    r,
+	})
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Offset: l.position,
+		Line:   l.line,
+		Column: l.position - l.lineStart + 1,
+	}
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
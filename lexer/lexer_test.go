@@ -140,3 +140,73 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x == "héllo"
+fn`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedOffset  int
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 0, 1, 1},
+		{"x", 4, 1, 5},
+		{"=", 6, 1, 7},
+		{"5", 8, 1, 9},
+		{";", 9, 1, 10},
+		{"x", 13, 2, 3},
+		{"==", 15, 2, 5},
+		{"héllo", 18, 2, 8},
+		{"fn", 27, 3, 1},
+		{"", 29, 3, 3},
+	}
+
+	l := NewLexer(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, test.expectedLiteral, tok.Literal)
+		}
+
+		expected := token.Position{Offset: test.expectedOffset, Line: test.expectedLine, Column: test.expectedColumn}
+		if tok.Position != expected {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, expected, tok.Position)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x = 5 % 2;\nlet s = \"open"
+
+	l := NewLexer(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics. got=%+v", diagnostics)
+	}
+
+	tests := []struct {
+		code  string
+		start token.Position
+		end   token.Position
+	}{
+		{"illegal-character", token.Position{Offset: 10, Line: 1, Column: 11}, token.Position{Offset: 11, Line: 1, Column: 12}},
+		{"unterminated-string", token.Position{Offset: 23, Line: 2, Column: 9}, token.Position{Offset: 28, Line: 2, Column: 14}},
+	}
+
+	for i, tt := range tests {
+		d := diagnostics[i]
+		if d.Code != tt.code || d.Range.Start != tt.start || d.Range.End != tt.end {
+			t.Errorf("diagnostics[%d] wrong. expected=%s at %+v-%+v, got=%+v", i, tt.code, tt.start, tt.end, d)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package lsp
+
+import (
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/diagnostic"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/token"
+	"sort"
+)
+
+type symbolKind int
+
+const (
+	variableSymbol symbolKind = iota
+	functionSymbol
+	parameterSymbol
+)
+
+type symbol struct {
+	name       string
+	kind       symbolKind
+	ident      *ast.Identifier
+	statement  *ast.LetStatement    // nil for parameters
+	function   *ast.FunctionLiteral // the function declaring the parameter, or the function bound by the let
+	children   []*symbol
+	references []*ast.Identifier
+}
+
+type scope struct {
+	outer   *scope
+	symbols map[string][]*symbol
+	start   int // offset where the scope begins
+	end     int // offset where the scope ends, -1 for the whole document
+}
+
+func newScope(outer *scope, start int, end int) *scope {
+	return &scope{outer: outer, symbols: make(map[string][]*symbol), start: start, end: end}
+}
+
+func (s *scope) define(sym *symbol) {
+	s.symbols[sym.name] = append(s.symbols[sym.name], sym)
+}
+
+// lookup returns the latest definition of name visible from s.
+func (s *scope) lookup(name string) *symbol {
+	for current := s; current != nil; current = current.outer {
+		if symbols := current.symbols[name]; len(symbols) > 0 {
+			return symbols[len(symbols)-1]
+		}
+	}
+	return nil
+}
+
+func (s *scope) contains(offset int) bool {
+	return s.start <= offset && (s.end < 0 || offset <= s.end)
+}
+
+type unresolved struct {
+	ident *ast.Identifier
+	scope *scope
+}
+
+type analysis struct {
+	program     *ast.Program
+	diagnostics []diagnostic.Diagnostic
+	symbols     []*symbol // top-level symbols, each holding the ones declared in its function
+	definitions map[*ast.Identifier]*symbol
+	uses        map[*ast.Identifier]*symbol
+	identifiers []*ast.Identifier // every identifier in the document, sorted by offset
+	scopes      []*scope
+	blockEnds   map[int]int // offset of each { to the offset of its matching }
+
+	pending    []func()
+	unresolved []unresolved
+}
+
+func analyze(text string) *analysis {
+	p := parser.NewParser(lexer.NewLexer(text))
+	a := &analysis{
+		program:     p.ParseProgram(),
+		diagnostics: p.Diagnostics(),
+		definitions: make(map[*ast.Identifier]*symbol),
+		uses:        make(map[*ast.Identifier]*symbol),
+		blockEnds:   matchBraces(text),
+	}
+
+	global := newScope(nil, 0, -1)
+	a.scopes = append(a.scopes, global)
+	a.symbols = append(a.symbols, a.resolveStatements(a.program.Statements, global, nil)...)
+
+	// Function bodies may refer to bindings declared after them, which only
+	// exist once the whole program has been seen.
+	for _, u := range a.unresolved {
+		for current := u.scope; current != nil; current = current.outer {
+			if symbols := current.symbols[u.ident.Value]; len(symbols) > 0 {
+				a.use(u.ident, symbols[0])
+				break
+			}
+		}
+	}
+
+	sort.Slice(a.identifiers, func(i, j int) bool {
+		return a.identifiers[i].Token.Position.Offset < a.identifiers[j].Token.Position.Offset
+	})
+
+	return a
+}
+
+func matchBraces(text string) map[int]int {
+	ends := make(map[int]int)
+	var open []int
+	l := lexer.NewLexer(text)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, tok.Position.Offset)
+		case token.RBRACE:
+			if len(open) > 0 {
+				ends[open[len(open)-1]] = tok.Position.Offset
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	for _, start := range open {
+		ends[start] = len(text)
+	}
+
+	return ends
+}
+
+func (a *analysis) resolveStatements(statements []ast.Statement, s *scope, container *symbol) []*symbol {
+	var declared []*symbol
+
+	for _, statement := range statements {
+		declared = append(declared, a.resolveStatement(statement, s, container)...)
+
+		// Function bodies run after the statement defining them, so they
+		// can see it, e.g. a recursive `let f = fn() { f() }`.
+		pending := a.pending
+		a.pending = nil
+		for _, resolve := range pending {
+			resolve()
+		}
+	}
+
+	return declared
+}
+
+func (a *analysis) resolveStatement(statement ast.Statement, s *scope, container *symbol) []*symbol {
+	switch n := statement.(type) {
+	case *ast.LetStatement:
+		sym := &symbol{name: n.Name.Value, kind: variableSymbol, ident: n.Name, statement: n}
+
+		if fn, ok := n.Value.(*ast.FunctionLiteral); ok {
+			sym.kind = functionSymbol
+			sym.function = fn
+			a.pending = append(a.pending, a.pendingFunction(fn, s, sym))
+		} else {
+			a.resolveExpression(n.Value, s, container)
+		}
+
+		s.define(sym)
+		a.definitions[n.Name] = sym
+		a.identifiers = append(a.identifiers, n.Name)
+		return []*symbol{sym}
+	case *ast.ReturnStatement:
+		a.resolveExpression(n.ReturnValue, s, container)
+	case *ast.ExpressionStatement:
+		a.resolveExpression(n.Expression, s, container)
+	case *ast.BlockStatement:
+		if n != nil {
+			return a.resolveStatements(n.Statements, s, container)
+		}
+	}
+
+	return nil
+}
+
+func (a *analysis) resolveExpression(expression ast.Expression, s *scope, container *symbol) {
+	switch n := expression.(type) {
+	case *ast.Identifier:
+		a.identifiers = append(a.identifiers, n)
+
+		if sym := s.lookup(n.Value); sym != nil {
+			a.use(n, sym)
+		} else {
+			a.unresolved = append(a.unresolved, unresolved{ident: n, scope: s})
+		}
+	case *ast.FunctionLiteral:
+		a.pending = append(a.pending, a.pendingFunction(n, s, container))
+	case *ast.PrefixExpression:
+		a.resolveExpression(n.Right, s, container)
+	case *ast.InfixExpression:
+		a.resolveExpression(n.Left, s, container)
+		a.resolveExpression(n.Right, s, container)
+	case *ast.IfExpression:
+		a.resolveExpression(n.Condition, s, container)
+		a.resolveBlock(n.Consequence, s, container)
+		a.resolveBlock(n.Alternative, s, container)
+	case *ast.CallExpression:
+		a.resolveExpression(n.Function, s, container)
+		for _, arg := range n.Arguments {
+			a.resolveExpression(arg, s, container)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range n.Elements {
+			a.resolveExpression(element, s, container)
+		}
+	case *ast.IndexExpression:
+		a.resolveExpression(n.Left, s, container)
+		a.resolveExpression(n.Index, s, container)
+	case *ast.SliceExpression:
+		a.resolveExpression(n.Left, s, container)
+		for _, bound := range []ast.Expression{n.Start, n.End, n.Step} {
+			if bound != nil {
+				a.resolveExpression(bound, s, container)
+			}
+		}
+	case *ast.MapLiteral:
+		for k, v := range n.Pairs {
+			a.resolveExpression(k, s, container)
+			a.resolveExpression(v, s, container)
+		}
+	}
+}
+
+// The statements of an if expression share the environment of the
+// enclosing function, so their bindings belong to the enclosing scope.
+func (a *analysis) resolveBlock(block *ast.BlockStatement, s *scope, container *symbol) {
+	if block == nil {
+		return
+	}
+
+	declared := a.resolveStatements(block.Statements, s, container)
+
+	if container != nil {
+		container.children = append(container.children, declared...)
+	} else if s.outer == nil {
+		a.symbols = append(a.symbols, declared...)
+	}
+}
+
+func (a *analysis) pendingFunction(fn *ast.FunctionLiteral, outer *scope, container *symbol) func() {
+	return func() {
+		if fn.Body == nil {
+			return
+		}
+
+		start := fn.Token.Position.Offset
+		end, ok := a.blockEnds[fn.Body.Token.Position.Offset]
+		if !ok {
+			end = -1
+		}
+
+		s := newScope(outer, start, end)
+		a.scopes = append(a.scopes, s)
+
+		for _, param := range fn.Parameters {
+			sym := &symbol{name: param.Value, kind: parameterSymbol, ident: param, function: fn}
+			s.define(sym)
+			a.definitions[param] = sym
+			a.identifiers = append(a.identifiers, param)
+		}
+
+		declared := a.resolveStatements(fn.Body.Statements, s, container)
+
+		if container != nil {
+			container.children = append(container.children, declared...)
+		}
+	}
+}
+
+func (a *analysis) use(ident *ast.Identifier, sym *symbol) {
+	a.uses[ident] = sym
+	sym.references = append(sym.references, ident)
+}
+
+// identifierAt returns the identifier spanning offset, if any.
+func (a *analysis) identifierAt(offset int) *ast.Identifier {
+	i := sort.Search(len(a.identifiers), func(i int) bool {
+		return identifierEnd(a.identifiers[i]) >= offset
+	})
+
+	if i < len(a.identifiers) && a.identifiers[i].Token.Position.Offset <= offset {
+		return a.identifiers[i]
+	}
+
+	return nil
+}
+
+func (a *analysis) symbolFor(ident *ast.Identifier) *symbol {
+	if sym, ok := a.definitions[ident]; ok {
+		return sym
+	}
+	return a.uses[ident]
+}
+
+// visibleSymbols returns the bindings that may be referred to at offset,
+// innermost first.
+func (a *analysis) visibleSymbols(offset int) []*symbol {
+	var visible []*symbol
+	seen := make(map[string]bool)
+
+	for i := len(a.scopes) - 1; i >= 0; i-- {
+		s := a.scopes[i]
+		if !s.contains(offset) {
+			continue
+		}
+
+		for name, symbols := range s.symbols {
+			if seen[name] {
+				continue
+			}
+
+			for j := len(symbols) - 1; j >= 0; j-- {
+				if symbols[j].ident.Token.Position.Offset < offset {
+					visible = append(visible, symbols[j])
+					seen[name] = true
+					break
+				}
+			}
+		}
+	}
+
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].name < visible[j].name
+	})
+
+	return visible
+}
+
+func identifierEnd(ident *ast.Identifier) int {
+	return ident.Token.Position.Offset + len(ident.Value)
+}
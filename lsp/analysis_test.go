@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveDefinitions(t *testing.T) {
+	input := `let total = 10;
+let add = fn(x, y) { x + y + total };
+let total = add(total, 1);
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+let later = fn() { helper() };
+let helper = fn() { 1 };`
+
+	tests := []struct {
+		use                string // the text of the use, followed by its occurrence
+		occurrence         int
+		expectedDefinition int // offset of the defining identifier
+	}{
+		{"x + y", 0, strings.Index(input, "x, y")},
+		{"y + total", 0, strings.Index(input, "y)")},
+		{"total }", 0, strings.Index(input, "total")},
+		{"total, 1", 0, strings.Index(input, "total")},
+		{"fact(n - 1)", 0, strings.Index(input, "fact")},
+		{"n * fact", 0, strings.Index(input, "n)")},
+		{"helper()", 0, strings.LastIndex(input, "helper")},
+	}
+
+	a := analyze(input)
+
+	if len(a.diagnostics) != 0 {
+		t.Fatalf("unexpected parse errors: %v", a.diagnostics)
+	}
+
+	for _, tt := range tests {
+		offset := strings.Index(input, tt.use)
+		ident := a.identifierAt(offset)
+
+		if ident == nil {
+			t.Errorf("no identifier found at %q", tt.use)
+			continue
+		}
+
+		sym := a.symbolFor(ident)
+
+		if sym == nil {
+			t.Errorf("identifier %q was not resolved", ident.Value)
+			continue
+		}
+
+		if sym.ident.Token.Position.Offset != tt.expectedDefinition {
+			t.Errorf("wrong definition for %q. expected=%d, got=%d",
+				tt.use, tt.expectedDefinition, sym.ident.Token.Position.Offset)
+		}
+	}
+}
+
+func TestVisibleSymbols(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+	let b = 2;
+	x + b
+};
+let c = 3;`
+
+	tests := []struct {
+		at       string
+		expected []string
+	}{
+		{"let a", nil},
+		{"let f", []string{"a"}},
+		{"x + b", []string{"a", "b", "f", "x"}},
+		{"let c", []string{"a", "f"}},
+	}
+
+	a := analyze(input)
+
+	for _, tt := range tests {
+		var names []string
+		for _, sym := range a.visibleSymbols(strings.Index(input, tt.at)) {
+			names = append(names, sym.name)
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("wrong visible symbols at %q. expected=%v, got=%v", tt.at, tt.expected, names)
+		}
+	}
+}
+
+func TestDocumentPositions(t *testing.T) {
+	doc := newDocument("file:///test.mnd", "let s = \"😀\";\nlet t = s;")
+
+	tests := []struct {
+		offset   int
+		expected Position
+	}{
+		{0, Position{Line: 0, Character: 0}},
+		{9, Position{Line: 0, Character: 9}},
+		{13, Position{Line: 0, Character: 11}},
+		{16, Position{Line: 1, Character: 0}},
+		{24, Position{Line: 1, Character: 8}},
+	}
+
+	for _, tt := range tests {
+		position := doc.position(tt.offset)
+
+		if position != tt.expected {
+			t.Errorf("wrong position for offset %d. expected=%+v, got=%+v", tt.offset, tt.expected, position)
+		}
+
+		if offset := doc.offset(position); offset != tt.offset {
+			t.Errorf("wrong offset for position %+v. expected=%d, got=%d", position, tt.offset, offset)
+		}
+	}
+}
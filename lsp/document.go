@@ -0,0 +1,74 @@
+package lsp
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+type document struct {
+	uri        string
+	text       string
+	lineStarts []int
+	analysis   *analysis
+}
+
+func newDocument(uri string, text string) *document {
+	d := &document{uri: uri, text: text, lineStarts: []int{0}}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+
+	d.analysis = analyze(text)
+	return d
+}
+
+// position converts a byte offset into a position counting UTF-16 code
+// units, as the protocol requires.
+func (d *document) position(offset int) Position {
+	offset = min(max(offset, 0), len(d.text))
+	line := sort.Search(len(d.lineStarts), func(i int) bool {
+		return d.lineStarts[i] > offset
+	}) - 1
+
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		character += utf16Length(r)
+	}
+
+	return Position{Line: line, Character: character}
+}
+
+func (d *document) offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[position.Line]
+	for character := 0; character < position.Character && offset < len(d.text); {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		character += utf16Length(r)
+		offset += size
+	}
+
+	return offset
+}
+
+func (d *document) rangeOf(start int, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,439 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	documents   map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends the exit notification or
+// closes the input.
+func (s *Server) Serve() error {
+	for {
+		body, err := s.readMessage()
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var msg message
+
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.respond(nil, nil, &responseError{Code: parseErrorCode, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, rpcErr := s.dispatch(msg)
+
+		if msg.ID == nil {
+			continue
+		}
+
+		if err := s.respond(msg.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) readMessage() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (s *Server) write(v any) error {
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) respond(id *json.RawMessage, result any, rpcErr *responseError) error {
+	res := response{JSONRPC: "2.0", ID: id, Error: rpcErr}
+
+	if rpcErr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		res.Result = encoded
+	}
+
+	return s.write(res)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// dispatch handles msg, turning a panic into an internal error so that one
+// bad request does not end the session.
+func (s *Server) dispatch(msg message) (result any, rpcErr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rpcErr = nil, &responseError{Code: internalErrorCode, Message: fmt.Sprint("internal error: ", r)}
+		}
+	}()
+
+	return s.handle(msg)
+}
+
+func (s *Server) handle(msg message) (any, *responseError) {
+	if !s.initialized && msg.Method != "initialize" {
+		if msg.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{Code: serverNotInitializedCode, Message: "server not initialized"}
+	}
+
+	if s.shutdown && msg.ID != nil {
+		return nil, &responseError{Code: invalidRequestCode, Message: "server is shutting down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return s.initialize(), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+		})
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			if len(params.ContentChanges) == 0 {
+				return nil, nil
+			}
+			// Only full synchronization is advertised, so the last change
+			// holds the whole document.
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			return nil, s.open(params.TextDocument.URI, text)
+		})
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			delete(s.documents, params.TextDocument.URI)
+			return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []Diagnostic{},
+			})
+		})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return s.definition(params), nil
+		})
+	case "textDocument/references":
+		var params ReferenceParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return s.references(params), nil
+		})
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return s.hover(params), nil
+		})
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return s.documentSymbols(params), nil
+		})
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		return decodeParams(msg.Params, &params, func() (any, error) {
+			return s.completion(params), nil
+		})
+	default:
+		if msg.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{Code: methodNotFoundCode, Message: "method not found: " + msg.Method}
+	}
+}
+
+func decodeParams(raw json.RawMessage, params any, handle func() (any, error)) (any, *responseError) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return nil, &responseError{Code: invalidParamsCode, Message: err.Error()}
+	}
+
+	result, err := handle()
+
+	if err != nil {
+		return nil, &responseError{Code: invalidRequestCode, Message: err.Error()}
+	}
+
+	return result, nil
+}
+
+func (s *Server) initialize() InitializeResult {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       syncFull,
+			DefinitionProvider:     true,
+			ReferencesProvider:     true,
+			HoverProvider:          true,
+			DocumentSymbolProvider: true,
+			CompletionProvider:     CompletionOptions{},
+		},
+		ServerInfo: ServerInfo{Name: "mandrill"},
+	}
+}
+
+func (s *Server) open(uri string, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+
+	for _, d := range doc.analysis.diagnostics {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.rangeOf(d.Range.Start.Offset, d.Range.End.Offset),
+			Severity: int(d.Severity),
+			Code:     d.Code,
+			Source:   "mandrill",
+			Message:  d.Message,
+		})
+	}
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) symbolAt(params TextDocumentPositionParams) (*document, *ast.Identifier, *symbol) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	ident := doc.analysis.identifierAt(doc.offset(params.Position))
+	if ident == nil {
+		return doc, nil, nil
+	}
+
+	return doc, ident, doc.analysis.symbolFor(ident)
+}
+
+func (s *Server) location(doc *document, ident *ast.Identifier) Location {
+	start := ident.Token.Position.Offset
+	return Location{URI: doc.uri, Range: doc.rangeOf(start, identifierEnd(ident))}
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) *Location {
+	doc, _, sym := s.symbolAt(params)
+	if sym == nil {
+		return nil
+	}
+
+	location := s.location(doc, sym.ident)
+	return &location
+}
+
+func (s *Server) references(params ReferenceParams) []Location {
+	doc, _, sym := s.symbolAt(params.TextDocumentPositionParams)
+	locations := []Location{}
+
+	if sym == nil {
+		return locations
+	}
+
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, s.location(doc, sym.ident))
+	}
+
+	for _, ref := range sym.references {
+		locations = append(locations, s.location(doc, ref))
+	}
+
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i].Range.Start, locations[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+
+	return locations
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	doc, ident, sym := s.symbolAt(params)
+	if ident == nil {
+		return nil
+	}
+
+	var value string
+
+	switch {
+	case sym != nil:
+		value = describe(sym)
+	case isBuiltin(ident.Value):
+		value = "(built-in function) " + ident.Value
+	default:
+		return nil
+	}
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```mandrill\n" + value + "\n```"},
+		Range:    s.location(doc, ident).Range,
+	}
+}
+
+func describe(sym *symbol) string {
+	if sym.kind == parameterSymbol {
+		return fmt.Sprintf("(parameter) %s of %s", sym.name, signature(sym.function))
+	}
+
+	if sym.statement.Value == nil {
+		return "let " + sym.name
+	}
+
+	if sym.kind == functionSymbol {
+		return "let " + sym.name + " = " + signature(sym.function)
+	}
+
+	return sym.statement.String()
+}
+
+func signature(fn *ast.FunctionLiteral) string {
+	var params []string
+	for _, p := range fn.Parameters {
+		params = append(params, p.Value)
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+func isBuiltin(name string) bool {
+	for _, builtin := range evaluator.BuiltinNames() {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) []DocumentSymbol {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return []DocumentSymbol{}
+	}
+
+	return documentSymbols(doc, doc.analysis.symbols)
+}
+
+func documentSymbols(doc *document, symbols []*symbol) []DocumentSymbol {
+	result := []DocumentSymbol{}
+
+	for _, sym := range symbols {
+		r := doc.rangeOf(sym.ident.Token.Position.Offset, identifierEnd(sym.ident))
+		docSymbol := DocumentSymbol{
+			Name:           sym.name,
+			Kind:           symbolKindVariable,
+			Range:          r,
+			SelectionRange: r,
+		}
+
+		if sym.kind == functionSymbol {
+			docSymbol.Kind = symbolKindFunction
+			docSymbol.Detail = signature(sym.function)
+			docSymbol.Range.Start = doc.position(sym.statement.Token.Position.Offset)
+			if end, ok := doc.analysis.blockEnds[sym.function.Body.Token.Position.Offset]; ok {
+				docSymbol.Range.End = doc.position(end + 1)
+			}
+			docSymbol.Children = documentSymbols(doc, sym.children)
+		}
+
+		result = append(result, docSymbol)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].SelectionRange.Start, result[j].SelectionRange.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+
+	return result
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+	items := []CompletionItem{}
+
+	if doc, ok := s.documents[params.TextDocument.URI]; ok {
+		for _, sym := range doc.analysis.visibleSymbols(doc.offset(params.Position)) {
+			item := CompletionItem{Label: sym.name, Kind: completionKindVariable}
+			if sym.kind == functionSymbol {
+				item.Kind = completionKindFunction
+				item.Detail = signature(sym.function)
+			}
+			items = append(items, item)
+		}
+	}
+
+	for _, name := range evaluator.BuiltinNames() {
+		items = append(items, CompletionItem{Label: name, Kind: completionKindFunction, Detail: "built-in function"})
+	}
+
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+
+	return items
+}
@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+const testURI = "file:///test.mnd"
+
+func TestServer(t *testing.T) {
+	text := "let add = fn(x, y) { x + y };\nadd(1, 2);\nlet z = ;"
+
+	var in bytes.Buffer
+	writeTestMessage(&in, 1, "initialize", map[string]any{})
+	writeTestMessage(&in, nil, "initialized", map[string]any{})
+	writeTestMessage(&in, nil, "textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "mandrill", Version: 1, Text: text},
+	})
+	writeTestMessage(&in, 2, "textDocument/definition", positionParams(1, 1))
+	writeTestMessage(&in, 3, "textDocument/references", map[string]any{
+		"textDocument": TextDocumentIdentifier{URI: testURI},
+		"position":     Position{Line: 0, Character: 13},
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+	writeTestMessage(&in, 4, "textDocument/hover", positionParams(1, 0))
+	writeTestMessage(&in, 5, "textDocument/documentSymbol", map[string]any{
+		"textDocument": TextDocumentIdentifier{URI: testURI},
+	})
+	writeTestMessage(&in, 6, "textDocument/completion", positionParams(0, 21))
+	writeTestMessage(&in, 7, "unknown/method", map[string]any{})
+	writeTestMessage(&in, 8, "shutdown", nil)
+	writeTestMessage(&in, nil, "exit", nil)
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve returned an error: %v", err)
+	}
+
+	r := bufio.NewReader(&out)
+
+	var initResult struct {
+		Result InitializeResult `json:"result"`
+	}
+	readTestMessage(t, r, &initResult)
+	if !initResult.Result.Capabilities.DefinitionProvider {
+		t.Errorf("definition provider not advertised")
+	}
+
+	var diagnostics struct {
+		Method string                   `json:"method"`
+		Params PublishDiagnosticsParams `json:"params"`
+	}
+	readTestMessage(t, r, &diagnostics)
+	if diagnostics.Method != "textDocument/publishDiagnostics" || len(diagnostics.Params.Diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic to be published. got=%+v", diagnostics)
+	}
+	expectedRange := Range{Start: Position{Line: 2, Character: 8}, End: Position{Line: 2, Character: 9}}
+	if diagnostics.Params.Diagnostics[0].Range != expectedRange {
+		t.Errorf("wrong diagnostic range. expected=%+v, got=%+v", expectedRange, diagnostics.Params.Diagnostics[0].Range)
+	}
+
+	var definition struct {
+		Result Location `json:"result"`
+	}
+	readTestMessage(t, r, &definition)
+	if definition.Result.Range.Start != (Position{Line: 0, Character: 4}) {
+		t.Errorf("wrong definition. got=%+v", definition.Result)
+	}
+
+	var references struct {
+		Result []Location `json:"result"`
+	}
+	readTestMessage(t, r, &references)
+	if len(references.Result) != 2 {
+		t.Fatalf("expected 2 references. got=%+v", references.Result)
+	}
+	if references.Result[1].Range.Start != (Position{Line: 0, Character: 21}) {
+		t.Errorf("wrong reference. got=%+v", references.Result[1])
+	}
+
+	var hover struct {
+		Result Hover `json:"result"`
+	}
+	readTestMessage(t, r, &hover)
+	if hover.Result.Contents.Value != "```mandrill\nlet add = fn(x, y)\n```" {
+		t.Errorf("wrong hover contents. got=%q", hover.Result.Contents.Value)
+	}
+
+	var symbols struct {
+		Result []DocumentSymbol `json:"result"`
+	}
+	readTestMessage(t, r, &symbols)
+	if len(symbols.Result) != 2 || symbols.Result[0].Name != "add" || symbols.Result[1].Name != "z" {
+		t.Errorf("wrong document symbols. got=%+v", symbols.Result)
+	}
+
+	var completion struct {
+		Result []CompletionItem `json:"result"`
+	}
+	readTestMessage(t, r, &completion)
+	labels := make(map[string]bool)
+	for _, item := range completion.Result {
+		labels[item.Label] = true
+	}
+	for _, expected := range []string{"add", "x", "y", "len", "let"} {
+		if !labels[expected] {
+			t.Errorf("completion is missing %q", expected)
+		}
+	}
+	if labels["z"] {
+		t.Errorf("completion offers %q before its definition", "z")
+	}
+
+	var unknown struct {
+		Error responseError `json:"error"`
+	}
+	readTestMessage(t, r, &unknown)
+	if unknown.Error.Code != methodNotFoundCode {
+		t.Errorf("wrong error code for unknown method. got=%d", unknown.Error.Code)
+	}
+
+	var shutdown struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	readTestMessage(t, r, &shutdown)
+	if shutdown.ID != 8 || string(shutdown.Result) != "null" {
+		t.Errorf("wrong shutdown response. got=%+v", shutdown)
+	}
+}
+
+func positionParams(line int, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func writeTestMessage(w io.Writer, id any, method string, params any) {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id != nil {
+		msg["id"] = id
+	}
+
+	body, _ := json.Marshal(msg)
+	_, _ = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func readTestMessage(t *testing.T, r *bufio.Reader, v any) {
+	t.Helper()
+
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("could not read message header: %v", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		t.Fatalf("invalid Content-Length header: %v", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		t.Fatalf("could not read message body: %v", err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("could not decode message %s: %v", body, err)
+	}
+}
+
+func TestHoverWithParseErrors(t *testing.T) {
+	var in bytes.Buffer
+	writeTestMessage(&in, 1, "initialize", map[string]any{})
+	writeTestMessage(&in, nil, "textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "mandrill", Version: 1, Text: "let x = 1 + ;\nx"},
+	})
+	writeTestMessage(&in, 2, "textDocument/hover", positionParams(1, 0))
+	writeTestMessage(&in, nil, "exit", nil)
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve returned an error: %v", err)
+	}
+
+	r := bufio.NewReader(&out)
+	readTestMessage(t, r, &struct{}{})
+	readTestMessage(t, r, &struct{}{})
+
+	var hover struct {
+		Result Hover `json:"result"`
+	}
+	readTestMessage(t, r, &hover)
+	if hover.Result.Contents.Value != "```mandrill\nlet x = (1 + );\n```" {
+		t.Errorf("wrong hover contents. got=%q", hover.Result.Contents.Value)
+	}
+}
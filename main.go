@@ -1,18 +1,73 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/coverage"
+	"example.com/writing-an-interpreter/dap"
+	"example.com/writing-an-interpreter/debugger"
+	"example.com/writing-an-interpreter/diagnostic"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/jupyter"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/lsp"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/profiler"
 	"example.com/writing-an-interpreter/repl"
+	"example.com/writing-an-interpreter/testrunner"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
+	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"os/user"
 )
 
+// Exit codes of the commands running programs.
+const (
+	exitRuntimeError = 1
+	exitUsage        = 2
+	exitParseError   = 3
+)
+
 func main() {
-	err := godotenv.Load()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lsp":
+			runLanguageServer()
+			return
+		case "debug":
+			runDebugger(os.Args[2:])
+			return
+		case "dap":
+			runDebugAdapter()
+			return
+		case "run":
+			runScript(os.Args[2:])
+			return
+		case "test":
+			runTests(os.Args[2:])
+			return
+		case "jupyter-kernel":
+			runJupyterKernel(os.Args[2:])
+			return
+		case "-e", "-":
+			os.Exit(runSource(os.Args[1], os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
 
-	if err != nil {
-		panic(err)
+	startRepl()
+}
+
+func startRepl() {
+	// The .env file is optional.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	u, err := user.Current()
@@ -24,5 +79,319 @@ func main() {
 	fmt.Printf("Hi, %s! This is the Mandrill programming language.\n", u.Username)
 	fmt.Println("Feel free to type in commands...")
 
-	repl.Start(os.Stdin, os.Stdout)
+	// The person typing at the prompt already has every kind of access.
+	repl.Start(os.Stdin, os.Stdout, object.AllCapabilities)
+}
+
+func runLanguageServer() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runDebugger(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	capabilities := capabilityFlags(flags)
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mandrill debug [flags] <script>")
+		flags.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := debugger.RunTerminal(os.Stdin, os.Stdout, string(source), capabilities()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runDebugAdapter() {
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runScript(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	cpuProfile := flags.String("cpuprofile", "", "write a pprof profile of the script to `file`")
+	foldedProfile := flags.String("folded", "", "write the profile as folded stacks for flame graphs to `file`")
+	cover := flags.Bool("cover", false, "print a coverage summary of the script")
+	coverProfile := flags.String("coverprofile", "", "write the coverage of the script in lcov format to `file`")
+	coverHTML := flags.String("coverhtml", "", "write an HTML coverage report of the script to `file`")
+	capabilities := capabilityFlags(flags)
+	diagnostics := flags.String("diagnostics", "text", "report errors as `text` or json")
+	maxMemory := flags.Int64("max-memory", 0, "fail once the script has allocated more than `bytes` to strings, arrays and maps")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mandrill run [flags] <script>")
+		flags.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+
+	report := func(d []diagnostic.Diagnostic, code int) {
+		if *diagnostics == "json" {
+			_ = diagnostic.WriteJSON(os.Stderr, d)
+		} else {
+			_ = diagnostic.WriteText(os.Stderr, filename, string(source), d)
+		}
+		os.Exit(code)
+	}
+
+	if d := p.Diagnostics(); len(d) > 0 {
+		report(d, exitParseError)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Context = ctx
+	interpreter.MemoryLimit = *maxMemory
+
+	interpreter.Capabilities = capabilities()
+
+	var tracers []evaluator.Tracer
+	var prof *profiler.Profiler
+	var collector *coverage.Collector
+
+	if *cpuProfile != "" || *foldedProfile != "" {
+		prof = profiler.NewProfiler(filename)
+		tracers = append(tracers, prof)
+	}
+
+	if *cover || *coverProfile != "" || *coverHTML != "" {
+		collector = coverage.NewCollector()
+		collector.Add(filename, string(source), program)
+		tracers = append(tracers, collector)
+	}
+
+	if len(tracers) > 0 {
+		interpreter.Tracer = evaluator.MultiTracer(tracers...)
+	}
+
+	result := interpreter.Eval(program, object.NewEnvironment())
+
+	if prof != nil {
+		prof.Stop()
+		writeProfile(*cpuProfile, prof.WriteProfile)
+		writeProfile(*foldedProfile, prof.WriteFolded)
+	}
+
+	if collector != nil {
+		if *cover {
+			_ = collector.WriteSummary(os.Stderr)
+		}
+		writeProfile(*coverProfile, collector.WriteLcov)
+		writeProfile(*coverHTML, collector.WriteHTML)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		report([]diagnostic.Diagnostic{evaluator.ErrorDiagnostic(err)}, exitRuntimeError)
+	}
+}
+
+// capabilityFlags defines the flags granting capabilities to the program
+// run, returning a function that returns the capabilities granted once the
+// flags are parsed.
+func capabilityFlags(flags *flag.FlagSet) func() object.Capability {
+	allowNet := flags.Bool("allow-net", false, "allow the script to access the network")
+	allowFS := flags.Bool("allow-fs", false, "allow the script to read and write files")
+	allowEnv := flags.Bool("allow-env", false, "allow the script to read environment variables")
+	allowClock := flags.Bool("allow-clock", false, "allow the script to read the clock")
+	allowAll := flags.Bool("allow-all", false, "allow every kind of access")
+
+	return func() object.Capability {
+		var capabilities object.Capability
+
+		for _, grant := range []struct {
+			allowed    bool
+			capability object.Capability
+		}{
+			{*allowNet, object.Network},
+			{*allowFS, object.Filesystem},
+			{*allowEnv, object.EnvironmentVariables},
+			{*allowClock, object.Clock},
+			{*allowAll, object.AllCapabilities},
+		} {
+			if grant.allowed {
+				capabilities |= grant.capability
+			}
+		}
+
+		return capabilities
+	}
+}
+
+// runSource runs a program given on the command line with -e, printing its
+// result, or read from the standard input with -, returning the exit code.
+// The expression comes right after -e, so that it is not taken for a flag
+// when it starts with a minus.
+func runSource(mode string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (code int) {
+	usage := func() int {
+		fmt.Fprintln(stderr, "usage: mandrill -e <expression> [flags]\n       mandrill - [flags] < script")
+		return exitUsage
+	}
+
+	var name string
+	var source string
+
+	if mode == "-e" {
+		if len(args) == 0 {
+			return usage()
+		}
+		name, source, args = "<expression>", args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	capabilities := capabilityFlags(flags)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		flags.PrintDefaults()
+		return usage()
+	}
+
+	if mode == "-" {
+		input, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitRuntimeError
+		}
+		name, source = "<stdin>", string(input)
+	}
+
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+
+	if d := p.Diagnostics(); len(d) > 0 {
+		_ = diagnostic.WriteText(stderr, name, source, d)
+		return exitParseError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// A bug of the interpreter fails the program like a runtime error.
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(stderr, "internal error:", r)
+			code = exitRuntimeError
+		}
+	}()
+
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Out = stdout
+	interpreter.Context = ctx
+	interpreter.Capabilities = capabilities()
+
+	result := interpreter.Eval(program, object.NewEnvironment())
+
+	if err, ok := result.(*object.Error); ok {
+		_ = diagnostic.WriteText(stderr, name, source, []diagnostic.Diagnostic{evaluator.ErrorDiagnostic(err)})
+		return exitRuntimeError
+	}
+
+	if mode == "-e" && result != nil && result != evaluator.NULL {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+
+	return 0
+}
+
+func runTests(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "list the tests that pass too")
+	capabilities := capabilityFlags(flags)
+	_ = flags.Parse(args)
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := testrunner.FindFiles(patterns)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !testrunner.Run(os.Stdout, files, *verbose, capabilities()) {
+		os.Exit(1)
+	}
+}
+
+func runJupyterKernel(args []string) {
+	flags := flag.NewFlagSet("jupyter-kernel", flag.ExitOnError)
+	capabilities := capabilityFlags(flags)
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mandrill jupyter-kernel [flags] <connection file>")
+		flags.PrintDefaults()
+		os.Exit(exitUsage)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+
+	var info jupyter.ConnectionInfo
+	if err == nil {
+		err = json.Unmarshal(data, &info)
+	}
+
+	var kernel *jupyter.Kernel
+	if err == nil {
+		kernel, err = jupyter.Listen(info, capabilities())
+	}
+
+	if err == nil {
+		err = kernel.Serve()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func writeProfile(filename string, write func(io.Writer) error) {
+	if filename == "" {
+		return
+	}
+
+	f, err := os.Create(filename)
+
+	if err == nil {
+		err = write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
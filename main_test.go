@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunSource(t *testing.T) {
+	tests := []struct {
+		mode   string
+		args   []string
+		stdin  string
+		code   int
+		output string
+	}{
+		{"-e", []string{"-5 + 1"}, "", 0, "-4\n"},
+		{"-e", []string{"len([1, 2, 3])", "--allow-all"}, "", 0, "3\n"},
+		{"-", nil, `print(upper("hi"))`, 0, "HI\n"},
+		{"-e", []string{"1 +"}, "", exitParseError, ""},
+		{"-e", []string{"1 / 0"}, "", exitRuntimeError, ""},
+		{"-", nil, "missing", exitRuntimeError, ""},
+		{"-e", nil, "", exitUsage, ""},
+		{"-e", []string{"1", "2"}, "", exitUsage, ""},
+		{"-e", []string{"1", "--unknown"}, "", exitUsage, ""},
+		{"-", []string{"script.mnd"}, "", exitUsage, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := runSource(tt.mode, tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("%s %q: wrong exit code. expected=%d, got=%d (%s)", tt.mode, tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.output {
+			t.Errorf("%s %q: wrong output. expected=%q, got=%q", tt.mode, tt.args, tt.output, stdout.String())
+		}
+		if (code != 0) != (stderr.Len() > 0) {
+			t.Errorf("%s %q: errors reported for exit code %d: %q", tt.mode, tt.args, code, stderr.String())
+		}
+	}
+}
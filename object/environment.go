@@ -29,3 +29,17 @@ func (e *Environment) Set(name string, value Object) Object {
 	e.store[name] = value
 	return value
 }
+
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Bindings returns a copy of the bindings stored directly in e, without
+// the ones of its outer environments.
+func (e *Environment) Bindings() map[string]Object {
+	bindings := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		bindings[name] = value
+	}
+	return bindings
+}
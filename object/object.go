@@ -2,16 +2,25 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/token"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 type ObjectType string
 
 const (
 	INTEGER      = "INTEGER"
+	FLOAT        = "FLOAT"
 	BOOLEAN      = "BOOLEAN"
 	STRING       = "STRING"
 	NULL         = "NULL"
@@ -21,6 +30,7 @@ const (
 	RETURN_VALUE = "RETURN_VALUE"
 	ERROR        = "ERROR"
 	BUILTIN      = "BUILTIN"
+	STRUCT       = "STRUCT"
 )
 
 type Object interface {
@@ -53,6 +63,26 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT
+}
+
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0" // tell whole floats apart from integers
+	}
+	return s
+}
+
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -99,6 +129,9 @@ func (rv *ReturnValue) Inspect() string {
 
 type Error struct {
 	Message string
+	// Position is where the error occurred, the position of the innermost
+	// node whose evaluation failed, or the zero value if unknown.
+	Position token.Position
 }
 
 func (e *Error) Type() ObjectType {
@@ -138,6 +171,14 @@ func (f *Function) Inspect() string {
 
 type String struct {
 	Value string
+	// offsets caches the byte offset of every rune of Value, followed by
+	// len(Value), once the string is indexed. It stays nil for ASCII strings,
+	// whose runes are their bytes.
+	offsets []int
+	indexed bool
+	// mu guards offsets and indexed, strings being shared by the sessions
+	// evaluating programs concurrently in the same environment.
+	mu sync.Mutex
 }
 
 func (s *String) Type() ObjectType {
@@ -148,18 +189,199 @@ func (s *String) Inspect() string {
 	return s.Value
 }
 
+// Len returns the number of runes of the string.
+func (s *String) Len() int {
+	s.Index(nil)
+	if s.offsets == nil {
+		return len(s.Value)
+	}
+	return len(s.offsets) - 1
+}
+
+// Substring returns the runes of the string from start up to end, which
+// must be within 0 and Len.
+func (s *String) Substring(start, end int) string {
+	s.Index(nil)
+	if s.offsets == nil {
+		return s.Value[start:end]
+	}
+	return s.Value[s.offsets[start]:s.offsets[end]]
+}
+
+// Index caches the offsets of the runes of the string used by Len and
+// Substring, unless they are cached already, accounting for the cache with
+// a, which may be nil. It returns an error, leaving the string as it is,
+// when the cache would exceed the memory limit of a.
+func (s *String) Index(a Allocator) *Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexed {
+		return nil
+	}
+
+	for i := 0; i < len(s.Value); i++ {
+		if s.Value[i] >= utf8.RuneSelf {
+			n := utf8.RuneCountInString(s.Value) + 1
+			// An int takes 8 bytes on a 64-bit platform.
+			size := 8 * int64(n)
+			if a != nil {
+				if err := a.Reserve(size); err != nil {
+					return err
+				}
+			}
+
+			offsets := make([]int, 0, n)
+			for offset := range s.Value {
+				offsets = append(offsets, offset)
+			}
+			s.offsets = append(offsets, len(s.Value))
+			s.indexed = true
+
+			if a != nil {
+				return a.Allocate(size)
+			}
+			return nil
+		}
+	}
+
+	s.indexed = true
+	return nil
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	_, _ = h.Write([]byte(s.Value))
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
-type BuiltinFunction func(args ...Object) Object
+// Capability is a kind of access to the world outside the interpreter,
+// which built-in functions can only use when it is granted.
+type Capability uint
+
+const (
+	Network Capability = 1 << iota
+	Filesystem
+	EnvironmentVariables
+	Clock
+
+	AllCapabilities = Network | Filesystem | EnvironmentVariables | Clock
+)
+
+func (c Capability) String() string {
+	var names []string
+
+	for _, capability := range []struct {
+		Capability
+		name string
+	}{
+		{Network, "network"},
+		{Filesystem, "filesystem"},
+		{EnvironmentVariables, "environment variable"},
+		{Clock, "clock"},
+	} {
+		if c&capability.Capability != 0 {
+			names = append(names, capability.name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// ParseCapability returns the capability with the given name, one of "net",
+// "fs", "env" and "clock", or every capability for "all".
+func ParseCapability(name string) (Capability, bool) {
+	switch name {
+	case "net":
+		return Network, true
+	case "fs":
+		return Filesystem, true
+	case "env":
+		return EnvironmentVariables, true
+	case "clock":
+		return Clock, true
+	case "all":
+		return AllCapabilities, true
+	default:
+		return 0, false
+	}
+}
+
+// BuiltinContext is passed to built-in functions by the interpreter
+// applying them.
+type BuiltinContext struct {
+	// Context is cancelled when the evaluation should stop.
+	Context context.Context
+	// Out is where the function should write its output.
+	Out io.Writer
+	// Position is where the call starts in the source, or the zero
+	// Position when the function is applied from Go.
+	Position token.Position
+	// Environment is the environment of the call site, or nil when the
+	// function is applied from Go.
+	Environment *Environment
+	// Apply calls a user-defined or built-in function.
+	Apply func(fn Object, args ...Object) Object
+	// Capabilities are the capabilities granted to the interpreter.
+	Capabilities Capability
+	// Allocator limits the memory allocated by the function, or is nil
+	// when it is not limited.
+	Allocator Allocator
+}
+
+// Allocator limits the memory allocated by an interpreter.
+type Allocator interface {
+	// Reserve returns an error when allocating the given number of bytes
+	// would exceed the limit.
+	Reserve(bytes int64) *Error
+	// Allocate accounts for the given number of bytes, allocated to create
+	// new values, returning an error once the limit is exceeded.
+	Allocate(bytes int64) *Error
+}
+
+// Reserve returns an error when allocating the given number of bytes would
+// exceed the memory limit, for functions to return before creating large
+// values.
+func (ctx *BuiltinContext) Reserve(bytes int64) *Error {
+	if ctx.Allocator == nil {
+		return nil
+	}
+	return ctx.Allocator.Reserve(bytes)
+}
+
+// Allocate accounts for the given number of bytes, allocated by the function
+// to create the values it returns, returning an error once the memory limit
+// is exceeded. Values returned by a function that already existed, such as
+// its arguments or their elements, are not accounted for again.
+func (ctx *BuiltinContext) Allocate(bytes int64) *Error {
+	if ctx.Allocator == nil {
+		return nil
+	}
+	return ctx.Allocator.Allocate(bytes)
+}
+
+// Require returns an error unless every capability in c is granted, for
+// functions to return instead of acting.
+func (ctx *BuiltinContext) Require(function string, c Capability) *Error {
+	if missing := c &^ ctx.Capabilities; missing != 0 {
+		return &Error{Message: fmt.Sprintf("`%s` needs %s access, which is not granted", function, missing)}
+	}
+	return nil
+}
+
+type BuiltinFunction func(ctx *BuiltinContext, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
 }
 
+// SimpleBuiltin returns a Builtin for a function that needs no context.
+func SimpleBuiltin(fn func(args ...Object) Object) *Builtin {
+	return &Builtin{Fn: func(_ *BuiltinContext, args ...Object) Object {
+		return fn(args...)
+	}}
+}
+
 func (b *Builtin) Type() ObjectType {
 	return BUILTIN
 }
@@ -218,3 +440,17 @@ func (m *Map) Inspect() string {
 
 	return out.String()
 }
+
+// Struct is a pointer to a Go struct bound to Mandrill, whose exported
+// fields and methods are accessed by indexing it with their names.
+type Struct struct {
+	Value reflect.Value
+}
+
+func (s *Struct) Type() ObjectType {
+	return STRUCT
+}
+
+func (s *Struct) Inspect() string {
+	return fmt.Sprintf("%+v", s.Value.Elem().Interface())
+}
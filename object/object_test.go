@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +20,64 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong representation of %v. expected=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestStringRunes(t *testing.T) {
+	tests := []struct {
+		value    string
+		length   int
+		start    int
+		end      int
+		expected string
+	}{
+		{"hello", 5, 1, 3, "el"},
+		{"héllo", 5, 1, 3, "él"},
+		{"日本語", 3, 2, 3, "語"},
+		{"a😀b", 3, 1, 2, "😀"},
+		{"", 0, 0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		s := &String{Value: tt.value}
+
+		if s.Len() != tt.length {
+			t.Errorf("wrong length of %q. expected=%d, got=%d", tt.value, tt.length, s.Len())
+		}
+		if got := s.Substring(tt.start, tt.end); got != tt.expected {
+			t.Errorf("wrong substring [%d:%d] of %q. expected=%q, got=%q", tt.start, tt.end, tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestStringRunesConcurrently(t *testing.T) {
+	s := &String{Value: "日本語"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := s.Substring(1, s.Len()); got != "本語" {
+				t.Errorf("wrong substring. got=%q", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
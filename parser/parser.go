@@ -2,10 +2,14 @@ package parser
 
 import (
 	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/diagnostic"
 	"example.com/writing-an-interpreter/lexer"
 	"example.com/writing-an-interpreter/token"
 	"fmt"
+	"sort"
 	"strconv"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -38,18 +42,44 @@ type (
 	infixParseFn  func(left ast.Expression) ast.Expression
 )
 
+type ParseError struct {
+	Message string
+	Token   token.Token // the token the error was found at
+	Code    string
+	Fix     *diagnostic.Fix
+}
+
+func (e ParseError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     e.Code,
+		Message:  e.Message,
+		Range:    diagnostic.TokenRange(e.Token),
+		Fix:      e.Fix,
+	}
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Token.Position.Line, e.Token.Position.Column, e.Message)
+}
+
 type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []ParseError
+	// panicking is set once an error is found in the statement being parsed,
+	// until the parser resynchronises at the start of the next one.
+	panicking bool
+	blocks    int // the number of blocks being parsed
+	braces    int // the number of braces opened and not closed up to curToken
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func NewParser(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []ParseError{}}
 	p.nextToken()
 	p.nextToken()
 
@@ -92,21 +122,78 @@ func (p *Parser) registerInfix(t token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) Errors() []string {
+	messages := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		messages[i] = err.Message
+	}
+	return messages
+}
+
+func (p *Parser) ParseErrors() []ParseError {
 	return p.errors
 }
 
-func (p *Parser) appendError(msg string) {
-	p.errors = append(p.errors, msg)
+// appendError records an error, unless one was already found in the
+// current statement, as following ones are most likely caused by it.
+func (p *Parser) appendError(code string, msg string, tok token.Token) {
+	p.appendErrorWithFix(code, msg, tok, nil)
+}
+
+func (p *Parser) appendErrorWithFix(code string, msg string, tok token.Token, fix *diagnostic.Fix) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, ParseError{Message: msg, Token: tok, Code: code, Fix: fix})
 }
 
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("Expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.appendError(msg)
+	var fix *diagnostic.Fix
+
+	// Punctuation is missing more often than not, and can be inserted
+	// after the current token.
+	if r, _ := utf8.DecodeRuneInString(string(t)); !unicode.IsLetter(r) {
+		end := diagnostic.TokenRange(p.curToken).End
+		fix = &diagnostic.Fix{
+			Message: fmt.Sprintf("insert `%s`", t),
+			Range:   diagnostic.Range{Start: end, End: end},
+			NewText: string(t),
+		}
+	}
+
+	p.appendErrorWithFix(diagnostic.MissingToken, msg, p.peekToken, fix)
+}
+
+// Diagnostics returns the errors found by the lexer and the parser, in the
+// order they appear in the input.
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	diagnostics := append([]diagnostic.Diagnostic{}, p.l.Diagnostics()...)
+
+	for _, err := range p.errors {
+		// The lexer describes illegal characters better.
+		if err.Token.Type != token.ILLEGAL {
+			diagnostics = append(diagnostics, err.Diagnostic())
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Range.Start.Offset < diagnostics[j].Range.Start.Offset
+	})
+
+	return diagnostics
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braces++
+	case token.RBRACE:
+		p.braces--
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -114,16 +201,77 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		statement := p.parseStatement()
+		statement := p.parseStatementAndRecover()
 		if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
-		p.nextToken()
 	}
 
 	return program
 }
 
+// parseStatementAndRecover parses a statement and advances to the next one.
+// If the statement has an error, the rest of it is skipped, so that parsing
+// resumes at the next statement and reports its own errors rather than ones
+// caused by the first.
+func (p *Parser) parseStatementAndRecover() ast.Statement {
+	enclosing := p.panicking
+	p.panicking = false
+
+	// The braces opened before the statement.
+	braces := p.braces
+	if p.curTokenIs(token.LBRACE) {
+		braces--
+	}
+
+	statement := p.parseStatement()
+
+	if p.panicking {
+		p.synchronize(braces)
+	} else {
+		p.nextToken()
+	}
+
+	p.panicking = enclosing
+	return statement
+}
+
+// synchronize advances to the start of the next statement: after a
+// semicolon, or to the closing brace of the enclosing block, or to a let or
+// return statement on a following line. braces is the number of braces
+// opened before the statement, so that a brace closing one opened in the
+// statement is not taken for the end of the enclosing block.
+func (p *Parser) synchronize(braces int) {
+	// The statement stopped at the end of the enclosing block.
+	if p.blocks > 0 && p.curTokenIs(token.RBRACE) && p.braces < braces {
+		return
+	}
+
+	// The braces opened when the error was found: the statement cannot end
+	// in a block opened after it.
+	depth := p.braces
+
+	for !p.curTokenIs(token.EOF) {
+		if p.blocks > 0 && p.braces <= braces && p.peekTokenIs(token.RBRACE) {
+			p.nextToken()
+			return
+		}
+		if p.braces <= depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				p.nextToken()
+				return
+			}
+			if (p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN)) &&
+				p.peekToken.Position.Line > p.curToken.Position.Line {
+				p.nextToken()
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
@@ -151,7 +299,7 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	p.nextToken()
 	statement.Value = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -181,7 +329,7 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	p.nextToken()
 	statement.ReturnValue = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -193,7 +341,7 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 
 	statement.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -205,13 +353,13 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	if prefixFn == nil {
 		msg := fmt.Sprintf("no prefixFn or infix parse function found for %s", p.curToken.Type)
-		p.appendError(msg)
+		p.appendError(diagnostic.UnexpectedToken, msg, p.curToken)
 		return nil
 	}
 
 	leftExp := prefixFn()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.panicking && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infixFn := p.infixParseFns[p.peekToken.Type]
 
 		if infixFn == nil {
@@ -233,7 +381,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.appendError(msg)
+		p.appendError(diagnostic.InvalidInteger, msg, p.curToken)
 		return nil
 	}
 	return &ast.IntegerLiteral{Token: p.curToken, Value: value}
@@ -331,15 +479,17 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken, Statements: []ast.Statement{}}
 	p.nextToken()
+	p.blocks++
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		statement := p.parseStatement()
+		statement := p.parseStatementAndRecover()
 		if statement != nil {
 			block.Statements = append(block.Statements, statement)
 		}
-		p.nextToken()
 	}
 
+	p.blocks--
+
 	return block
 }
 
@@ -390,18 +540,15 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 }
 
 func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
-	return &ast.CallExpression{
-		Token:     p.curToken,
-		Function:  left,
-		Arguments: p.parseExpressionList(token.RPAREN),
-	}
+	exp := &ast.CallExpression{Token: p.curToken, Function: left}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.curToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
-	}
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
@@ -432,10 +579,32 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseIndexExpression parses left[index], or the slice left[start:end:step]
+// where every bound is optional.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
+	var index ast.Expression
+
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+		}
+	}
+
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: index}
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	exp.End = p.parseSliceBound()
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Step = p.parseSliceBound()
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -444,11 +613,20 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
-func (p *Parser) parseMapLiteral() ast.Expression {
-	return &ast.MapLiteral{
-		Token: p.curToken,
-		Pairs: p.parseExpressionPairs(),
+// parseSliceBound parses the bound following the current colon, if any.
+func (p *Parser) parseSliceBound() ast.Expression {
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+		return nil
 	}
+
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseMapLiteral() ast.Expression {
+	m := &ast.MapLiteral{Token: p.curToken}
+	m.Pairs = p.parseExpressionPairs()
+	return m
 }
 
 func (p *Parser) parseExpressionPairs() map[ast.Expression]ast.Expression {
@@ -460,7 +638,7 @@ func (p *Parser) parseExpressionPairs() map[ast.Expression]ast.Expression {
 
 		if k == nil {
 			msg := fmt.Sprintf("Map key must be an expression, received a statement instead")
-			p.appendError(msg)
+			p.appendError(diagnostic.UnexpectedToken, msg, p.curToken)
 			return nil
 		}
 
@@ -4,6 +4,7 @@ import (
 	"example.com/writing-an-interpreter/ast"
 	"example.com/writing-an-interpreter/lexer"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -878,6 +879,43 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs[1:2]", "(xs[1:2])"},
+		{"xs[1:]", "(xs[1:])"},
+		{"xs[:2]", "(xs[:2])"},
+		{"xs[:]", "(xs[:])"},
+		{"xs[::2]", "(xs[::2])"},
+		{"xs[1:2:3]", "(xs[1:2:3])"},
+		{"xs[-1:]", "(xs[(-1):])"},
+		{"xs[a + 1:len(xs) - 1:-1]", "(xs[(a + 1):(len(xs) - 1):(-1)])"},
+		{"xs[1:][0]", "((xs[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	stmt := NewParser(lexer.NewLexer("xs[:2]")).ParseProgram().Statements[0].(*ast.ExpressionStatement)
+	slice, ok := stmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+	}
+	if slice.Start != nil || slice.Step != nil {
+		t.Errorf("omitted bounds are not nil. got start=%v, step=%v", slice.Start, slice.Step)
+	}
+	testIntegerLiteral(t, slice.End, 2)
+}
+
 func TestParsingMapLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	l := lexer.NewLexer(input)
@@ -962,3 +1000,131 @@ func TestParsingMapLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestParseErrorPositions(t *testing.T) {
+	input := `let x = 5;
+let = 10;`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	err := errors[0]
+	if err.Message != "Expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+	if err.Token.Position.Line != 2 || err.Token.Position.Column != 5 {
+		t.Errorf("wrong error position. got=%+v", err.Token.Position)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements int
+	}{
+		{
+			"let x 5;\nlet y = 10;\nlet add = fn(a, b) { a + };\nlet z = add(1, 2;\nreturn x\nlet = 3",
+			[]string{
+				"1:7: Expected next token to be =, got INT instead",
+				"3:26: no prefixFn or infix parse function found for }",
+				"4:17: Expected next token to be ), got ; instead",
+				"6:5: Expected next token to be IDENT, got = instead",
+			},
+			4,
+		},
+		{
+			"let f = fn(a b) {\n  let y = a;\n  y\n}\nlet = 3",
+			[]string{
+				"1:14: Expected next token to be ), got IDENT instead",
+				"5:5: Expected next token to be IDENT, got = instead",
+			},
+			1,
+		},
+		{
+			"if (x { 1 } else { 2 }\nlet y = 1\nlet z = )",
+			[]string{
+				"1:7: Expected next token to be ), got { instead",
+				"3:9: no prefixFn or infix parse function found for )",
+			},
+			3,
+		},
+		{
+			"let f = fn() {\n  let = 1\n  let y = ;\n  y\n}\nlet ok = 1",
+			[]string{
+				"2:7: Expected next token to be IDENT, got = instead",
+				"3:11: no prefixFn or infix parse function found for ;",
+			},
+			2,
+		},
+		{
+			"let x = [1, 2\nlet y = 2",
+			[]string{"2:1: Expected next token to be ], got LET instead"},
+			2,
+		},
+		{
+			"let m = {\"a\" 1};\nlet x = 1;",
+			[]string{"1:14: Expected next token to be :, got INT instead"},
+			2,
+		},
+		{
+			"let f = fn() { let x = {1 2}; let y = 3 };\nlet z = 1;",
+			[]string{"1:27: Expected next token to be :, got INT instead"},
+			2,
+		},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+
+		var errors []string
+		for _, err := range p.ParseErrors() {
+			errors = append(errors, err.Error())
+		}
+
+		if strings.Join(errors, "\n") != strings.Join(tt.errors, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected:\n%s\ngot:\n%s", tt.input,
+				strings.Join(tt.errors, "\n"), strings.Join(errors, "\n"))
+		}
+		if len(program.Statements) != tt.statements {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d", tt.input, tt.statements, len(program.Statements))
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x = add(1, 2;\nlet y = 5 % 2\nlet = 3"
+
+	p := NewParser(lexer.NewLexer(input))
+	p.ParseProgram()
+	diagnostics := p.Diagnostics()
+
+	var codes []string
+	for _, d := range diagnostics {
+		codes = append(codes, fmt.Sprintf("%s %s", d.Code, d.Error()))
+	}
+
+	expected := []string{
+		"missing-token 1:17: Expected next token to be ), got ; instead",
+		"illegal-character 2:11: illegal character '%'",
+		"missing-token 3:5: Expected next token to be IDENT, got = instead",
+	}
+	if strings.Join(codes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("wrong diagnostics.\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(codes, "\n"))
+	}
+
+	fix := diagnostics[0].Fix
+	if fix == nil || fix.NewText != ")" || fix.Range.Start.Offset != 16 || fix.Range.End.Offset != 16 {
+		t.Errorf("wrong fix for the missing parenthesis. got=%+v", fix)
+	}
+	if diagnostics[2].Fix != nil {
+		t.Errorf("expected no fix for a missing identifier. got=%+v", diagnostics[2].Fix)
+	}
+}
@@ -0,0 +1,202 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Field numbers of the messages in pprof's profile.proto.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		b.data = append(b.data, byte(v)|0x80)
+		v >>= 7
+	}
+	b.data = append(b.data, byte(v))
+}
+
+func (b *protobuf) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protobuf) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *protobuf) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protobuf) string(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) message(field int, build func(*protobuf)) {
+	var m protobuf
+	build(&m)
+	b.key(field, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+func (b *protobuf) packed(field int, values []uint64) {
+	var m protobuf
+	for _, v := range values {
+		m.varint(v)
+	}
+	b.key(field, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+type profileBuilder struct {
+	strings   []string
+	stringIDs map[string]int64
+	functions map[function]uint64
+	locations map[location]uint64
+	out       protobuf
+}
+
+func (pb *profileBuilder) addString(s string) int64 {
+	if id, ok := pb.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(pb.strings))
+	pb.strings = append(pb.strings, s)
+	pb.stringIDs[s] = id
+	return id
+}
+
+func (pb *profileBuilder) addFunction(f function, filename string) uint64 {
+	if id, ok := pb.functions[f]; ok {
+		return id
+	}
+
+	id := uint64(len(pb.functions) + 1)
+	pb.functions[f] = id
+	pb.out.message(profileFunction, func(m *protobuf) {
+		m.uint64(functionID, id)
+		m.int64(functionName, pb.addString(f.name))
+		m.int64(functionFilename, pb.addString(filename))
+		m.int64(functionStartLine, int64(f.startLine))
+	})
+	return id
+}
+
+func (pb *profileBuilder) addLocation(loc location, filename string) uint64 {
+	if id, ok := pb.locations[loc]; ok {
+		return id
+	}
+
+	fid := pb.addFunction(loc.function, filename)
+	id := uint64(len(pb.locations) + 1)
+	pb.locations[loc] = id
+	pb.out.message(profileLocation, func(m *protobuf) {
+		m.uint64(locationID, id)
+		m.message(locationLine, func(line *protobuf) {
+			line.uint64(lineFunctionID, fid)
+			line.int64(lineLine, int64(loc.line))
+		})
+	})
+	return id
+}
+
+// WriteProfile writes the profile as a gzipped pprof protocol buffer, with
+// the number of calls, the time and the heap allocations of every sample.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	pb := &profileBuilder{
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		functions: make(map[function]uint64),
+		locations: make(map[location]uint64),
+	}
+
+	sampleTypes := [][2]string{
+		{"calls", "count"},
+		{"time", "nanoseconds"},
+		{"alloc_objects", "count"},
+		{"alloc_space", "bytes"},
+	}
+
+	for _, st := range sampleTypes {
+		pb.out.message(profileSampleType, func(m *protobuf) {
+			m.int64(valueTypeType, pb.addString(st[0]))
+			m.int64(valueTypeUnit, pb.addString(st[1]))
+		})
+	}
+
+	for _, s := range p.sortedSamples() {
+		var ids []uint64
+		for _, loc := range s.stack {
+			ids = append(ids, pb.addLocation(loc, p.filename))
+		}
+
+		pb.out.message(profileSample, func(m *protobuf) {
+			m.packed(sampleLocationID, ids)
+			m.packed(sampleValue, []uint64{
+				uint64(s.calls),
+				uint64(s.nanoseconds),
+				uint64(s.allocObjects),
+				uint64(s.allocBytes),
+			})
+		})
+	}
+
+	pb.out.int64(profileTimeNanos, p.start.UnixNano())
+	pb.out.int64(profileDurationNanos, p.last.Sub(p.start).Nanoseconds())
+	pb.out.int64(profileDefaultSampleType, pb.addString("time"))
+
+	for _, s := range pb.strings {
+		pb.out.string(profileStringTable, s)
+	}
+
+	gz := gzip.NewWriter(w)
+
+	if _, err := gz.Write(pb.out.data); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
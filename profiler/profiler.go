@@ -0,0 +1,221 @@
+package profiler
+
+import (
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"io"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	allocObjectsMetric = "/gc/heap/allocs:objects"
+	allocBytesMetric   = "/gc/heap/allocs:bytes"
+)
+
+type function struct {
+	name      string
+	startLine int
+}
+
+type frame struct {
+	function function
+	line     int   // the line being evaluated, or the call site of the frame above
+	callers  *node // the stack of the frames below
+}
+
+type location struct {
+	function function
+	line     int
+}
+
+type sample struct {
+	stack        []location // innermost first
+	calls        int64
+	nanoseconds  int64
+	allocObjects int64
+	allocBytes   int64
+}
+
+// node is a stack in the tree of the stacks evaluated, found from its
+// callers without allocating once it has been seen, so that the profiler
+// does not count its own bookkeeping in the allocations of a program.
+type node struct {
+	sample  *sample
+	callees map[location]*node
+}
+
+// Profiler attributes the time and heap allocations of an evaluation to the
+// Mandrill functions and lines being evaluated. It implements
+// evaluator.Tracer.
+type Profiler struct {
+	filename string
+	start    time.Time
+	stack    []frame
+	samples  []*sample
+
+	last      time.Time
+	allocs    []metrics.Sample
+	lastAlloc [2]uint64
+}
+
+func NewProfiler(filename string) *Profiler {
+	p := &Profiler{
+		filename: filename,
+		start:    time.Now(),
+		stack:    []frame{{function: function{name: "<main>", startLine: 1}, callers: &node{}}},
+		allocs:   []metrics.Sample{{Name: allocObjectsMetric}, {Name: allocBytesMetric}},
+	}
+	p.last = p.start
+	p.lastAlloc = p.readAllocs()
+	return p
+}
+
+func (p *Profiler) readAllocs() [2]uint64 {
+	metrics.Read(p.allocs)
+
+	var values [2]uint64
+	for i, s := range p.allocs {
+		if s.Value.Kind() == metrics.KindUint64 {
+			values[i] = s.Value.Uint64()
+		}
+	}
+	return values
+}
+
+// flush attributes everything since the previous flush to the current stack.
+func (p *Profiler) flush() *sample {
+	now := time.Now()
+	allocs := p.readAllocs()
+
+	s := p.currentSample()
+	s.nanoseconds += now.Sub(p.last).Nanoseconds()
+	s.allocObjects += int64(allocs[0] - p.lastAlloc[0])
+	s.allocBytes += int64(allocs[1] - p.lastAlloc[1])
+
+	p.last = now
+	p.lastAlloc = allocs
+	return s
+}
+
+func (p *Profiler) currentSample() *sample {
+	return p.current().sample
+}
+
+// current returns the node of the stack being evaluated.
+func (p *Profiler) current() *node {
+	top := p.stack[len(p.stack)-1]
+	loc := location{function: top.function, line: top.line}
+
+	n, ok := top.callers.callees[loc]
+	if ok {
+		return n
+	}
+
+	stack := make([]location, len(p.stack))
+	for i, f := range p.stack {
+		stack[len(p.stack)-1-i] = location{function: f.function, line: f.line}
+	}
+
+	n = &node{sample: &sample{stack: stack}}
+	p.samples = append(p.samples, n.sample)
+
+	if top.callers.callees == nil {
+		top.callers.callees = make(map[location]*node)
+	}
+	top.callers.callees[loc] = n
+
+	return n
+}
+
+func (p *Profiler) Statement(statement ast.Statement, _ *object.Environment) {
+	p.flush()
+	p.stack[len(p.stack)-1].line = statement.Position().Line
+}
+
+func (p *Profiler) Call(call *ast.CallExpression, fn object.Object, _ *object.Environment) {
+	p.flush()
+
+	if call != nil {
+		p.stack[len(p.stack)-1].line = call.Position().Line
+	}
+
+	f := function{name: frameName(call, fn)}
+	if userFunction, ok := fn.(*object.Function); ok {
+		f.startLine = userFunction.Body.Position().Line
+	}
+
+	p.stack = append(p.stack, frame{function: f, line: f.startLine, callers: p.current()})
+	p.currentSample().calls++
+}
+
+func (p *Profiler) Return(_ *ast.CallExpression, _ object.Object, _ object.Object) {
+	p.flush()
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+func (p *Profiler) Branch(_ *ast.IfExpression, _ bool) {
+}
+
+// Stop ends the profile, attributing the remaining time to the program.
+func (p *Profiler) Stop() {
+	p.flush()
+}
+
+func frameName(call *ast.CallExpression, fn object.Object) string {
+	if call != nil {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			return ident.Value
+		}
+	}
+
+	if userFunction, ok := fn.(*object.Function); ok {
+		return fmt.Sprintf("<anonymous:%d>", userFunction.Body.Position().Line)
+	}
+
+	return "<anonymous>"
+}
+
+func (p *Profiler) sortedSamples() []*sample {
+	samples := append([]*sample(nil), p.samples...)
+
+	sort.Slice(samples, func(i, j int) bool {
+		return foldedStack(samples[i]) < foldedStack(samples[j])
+	})
+
+	return samples
+}
+
+func foldedStack(s *sample) string {
+	names := make([]string, len(s.stack))
+	for i, loc := range s.stack {
+		names[len(s.stack)-1-i] = loc.function.name
+	}
+	return strings.Join(names, ";")
+}
+
+// WriteFolded writes the time spent in each stack, in microseconds, in the
+// folded format used by flame graph tools.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	totals := make(map[string]int64)
+	var stacks []string
+
+	for _, s := range p.sortedSamples() {
+		stack := foldedStack(s)
+		if _, ok := totals[stack]; !ok {
+			stacks = append(stacks, stack)
+		}
+		totals[stack] += s.nanoseconds
+	}
+
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, totals[stack]/int64(time.Microsecond)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
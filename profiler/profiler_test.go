@@ -0,0 +1,160 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testProgram = `let countdown = fn(n) {
+	if (n == 0) { return 0; }
+	countdown(n - 1)
+};
+let xs = [1, 2, 3];
+countdown(len(xs));`
+
+func testProfile(t *testing.T) *Profiler {
+	p := parser.NewParser(lexer.NewLexer(testProgram))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	prof := NewProfiler("test.mnd")
+	in := evaluator.NewInterpreter()
+	in.Tracer = prof
+	in.Eval(program, object.NewEnvironment())
+	prof.Stop()
+
+	return prof
+}
+
+func TestCallCounts(t *testing.T) {
+	prof := testProfile(t)
+
+	calls := make(map[string]int64)
+	for _, s := range prof.sortedSamples() {
+		calls[foldedStack(s)] += s.calls
+	}
+
+	expected := map[string]int64{
+		"<main>":                               0,
+		"<main>;len":                           1,
+		"<main>;countdown":                     1,
+		"<main>;countdown;countdown":           1,
+		"<main>;countdown;countdown;countdown": 1,
+		"<main>;countdown;countdown;countdown;countdown": 1,
+	}
+
+	for stack, count := range expected {
+		if calls[stack] != count {
+			t.Errorf("wrong number of calls for %q. expected=%d, got=%d", stack, count, calls[stack])
+		}
+	}
+
+	if len(calls) != len(expected) {
+		t.Errorf("wrong stacks. got=%v", calls)
+	}
+}
+
+func TestCallSites(t *testing.T) {
+	prof := testProfile(t)
+
+	for _, s := range prof.sortedSamples() {
+		if foldedStack(s) != "<main>;countdown;countdown" || s.calls == 0 {
+			continue
+		}
+
+		if s.stack[0].line != 1 || s.stack[1].line != 3 || s.stack[2].line != 6 {
+			t.Errorf("wrong lines. got=%+v", s.stack)
+		}
+		return
+	}
+
+	t.Errorf("no sample found for the recursive call")
+}
+
+func TestWriteFolded(t *testing.T) {
+	var out bytes.Buffer
+	if err := testProfile(t).WriteFolded(&out); err != nil {
+		t.Fatalf("WriteFolded returned an error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("wrong number of stacks. got=%q", out.String())
+	}
+
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) != 2 || !strings.HasPrefix(fields[0], "<main>") {
+			t.Errorf("malformed line %q", line)
+		}
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	var out bytes.Buffer
+	if err := testProfile(t).WriteProfile(&out); err != nil {
+		t.Fatalf("WriteProfile returned an error: %v", err)
+	}
+
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("could not read profile: %v", err)
+	}
+
+	for _, s := range []string{"countdown", "test.mnd", "alloc_objects", "nanoseconds"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("profile does not contain %q", s)
+		}
+	}
+}
+
+func TestProtobufEncoding(t *testing.T) {
+	var b protobuf
+	b.uint64(1, 300)
+	b.string(2, "hi")
+	b.packed(3, []uint64{1, 2})
+	b.int64(4, 0)
+
+	expected := []byte{0x08, 0xac, 0x02, 0x12, 0x02, 'h', 'i', 0x1a, 0x02, 0x01, 0x02}
+	if !bytes.Equal(b.data, expected) {
+		t.Errorf("wrong encoding. expected=%x, got=%x", expected, b.data)
+	}
+}
+
+func TestOwnAllocationsNotCounted(t *testing.T) {
+	p := parser.NewParser(lexer.NewLexer("let x = true;\n" + strings.Repeat("x; ", 1000)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	prof := NewProfiler("test.mnd")
+	in := evaluator.NewInterpreter()
+	in.Tracer = prof
+	in.Eval(program, object.NewEnvironment())
+	prof.Stop()
+
+	var objects int64
+	for _, s := range prof.sortedSamples() {
+		objects += s.allocObjects
+	}
+
+	// Only setting up the evaluation and the first sample of each stack
+	// allocate, not the 1000 statements.
+	if objects > 200 {
+		t.Errorf("too many allocations counted for a program that does not allocate. got=%d", objects)
+	}
+}
@@ -0,0 +1,236 @@
+package repl
+
+import (
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/diagnostic"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a REPL command, a line starting with a colon, which inspects
+// or manages the session rather than being evaluated.
+type command struct {
+	name string
+	args string
+	help string
+	run  func(s *session, arg string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"tokens", "<code>", "list the tokens of the code", (*session).tokens},
+		{"ast", "<code>", "show the syntax tree of the code", (*session).ast},
+		{"env", "", "list the bindings of the session", (*session).listBindings},
+		{"type", "<code>", "evaluate the code, without binding any name, and show the type of the result", (*session).typeOf},
+		{"load", "<file>", "evaluate a file in the session", (*session).load},
+		{"save", "<file>", "save the inputs evaluated without errors as a script", (*session).save},
+		{"snapshot", "<file>", "save the bindings of the session", (*session).snapshot},
+		{"restore", "<file>", "restore the bindings saved by :snapshot", (*session).restore},
+		{"reset", "", "remove every binding made in the session", (*session).reset},
+		{"help", "", "list the commands", (*session).help},
+	}
+}
+
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+func (s *session) command(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), ":"), " ")
+	arg = strings.TrimSpace(arg)
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if c.args != "" && arg == "" {
+			_, err := fmt.Fprintf(s.out, "usage: :%s %s\n", c.name, c.args)
+			return err
+		}
+		return c.run(s, arg)
+	}
+
+	_, err := fmt.Fprintf(s.out, "unknown command :%s, type :help for a list of commands\n", name)
+	return err
+}
+
+func (s *session) tokens(code string) error {
+	l := lexer.NewLexer(code)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		_, err := fmt.Fprintf(s.out, "%d:%-4d %-9s %q\n", tok.Position.Line, tok.Position.Column, tok.Type, tok.Literal)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *session) ast(code string) error {
+	program, diagnostics := parse(code)
+
+	if valid, err := s.validate(code, diagnostics); !valid {
+		return err
+	}
+
+	return writeTree(s.out, program, "", "")
+}
+
+// writeTree writes node and its descendants, one per line, with the lines
+// that connect them.
+func writeTree(w io.Writer, node ast.Node, prefix string, childPrefix string) error {
+	if _, err := fmt.Fprintf(w, "%s%s\n", prefix, describe(node)); err != nil {
+		return err
+	}
+
+	children := ast.Children(node)
+
+	for i, child := range children {
+		var err error
+		if i == len(children)-1 {
+			err = writeTree(w, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			err = writeTree(w, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func describe(node ast.Node) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return name + " " + n.Value
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return name + " " + n.TokenLiteral()
+	case *ast.StringLiteral:
+		return fmt.Sprintf("%s %q", name, n.Value)
+	case *ast.PrefixExpression:
+		return name + " " + n.Operator
+	case *ast.InfixExpression:
+		return name + " " + n.Operator
+	default:
+		return name
+	}
+}
+
+func (s *session) listBindings(string) error {
+	bindings := s.bindings()
+	names := make([]string, 0, len(bindings))
+
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := bindings[name]
+		_, err := fmt.Fprintf(s.out, "%s: %s = %s\n", name, value.Type(), s.printer.flat(value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *session) typeOf(code string) error {
+	program, diagnostics := parse(code)
+
+	if valid, err := s.validate(code, diagnostics); !valid {
+		return err
+	}
+
+	// The code is evaluated in an environment of its own, so that it leaves
+	// the session as it was, like the other inspection commands.
+	result := s.interpreter.Eval(program, object.NewEnclosedEnvironment(s.env))
+
+	if result == nil {
+		result = evaluator.NULL
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		_, werr := io.WriteString(s.out, err.Inspect()+"\n")
+		return werr
+	}
+
+	_, err := fmt.Fprintln(s.out, result.Type())
+	return err
+}
+
+// requireFilesystem reports whether the session is granted filesystem
+// access, which commands reading or writing files need, printing an error
+// otherwise.
+func (s *session) requireFilesystem(command string) (bool, error) {
+	ctx := &object.BuiltinContext{Capabilities: s.interpreter.Capabilities}
+
+	if err := ctx.Require(":"+command, object.Filesystem); err != nil {
+		_, werr := io.WriteString(s.out, err.Inspect()+"\n")
+		return false, werr
+	}
+
+	return true, nil
+}
+
+func (s *session) load(filename string) error {
+	if granted, err := s.requireFilesystem("load"); !granted {
+		return err
+	}
+
+	source, err := os.ReadFile(filename)
+
+	if err != nil {
+		_, err = fmt.Fprintln(s.out, err)
+		return err
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		return diagnostic.WriteText(s.out, filename, string(source), diagnostics)
+	}
+
+	s.recordSources(string(source), program)
+
+	if err, ok := s.interpreter.Eval(program, s.env).(*object.Error); ok {
+		_, werr := io.WriteString(s.out, err.Inspect()+"\n")
+		return werr
+	}
+
+	s.record(string(source))
+	return nil
+}
+
+func (s *session) reset(string) error {
+	s.env = object.NewEnclosedEnvironment(s.base)
+	s.inputs = nil
+	s.sources = make(map[*ast.BlockStatement]string)
+	return nil
+}
+
+func (s *session) help(string) error {
+	for _, c := range commands {
+		usage := strings.TrimSpace(":" + c.name + " " + c.args)
+		if _, err := fmt.Fprintf(s.out, "%-16s %s\n", usage, c.help); err != nil {
+			return err
+		}
+	}
+	return nil
+}
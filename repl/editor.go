@@ -0,0 +1,409 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by readLine when Ctrl-C is pressed.
+var errInterrupted = errors.New("interrupted")
+
+// Control keys.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Keys read as escape sequences, mapped outside of the range of runes.
+const (
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// lineEditor reads lines from a terminal in raw mode, interpreting the keys
+// that move the cursor, edit the line, browse and search the history and
+// complete identifiers.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *history
+	complete func(prefix string) []string
+	// highlight, if set, returns the line to display for the line typed.
+	highlight func(line string) string
+
+	prompt string
+	line   []rune
+	cursor int
+	// historyIndex is the index of the history entry being edited, or the
+	// number of entries for a new line, saved in draft while browsing.
+	historyIndex int
+	draft        []rune
+	lastKey      rune
+}
+
+func newLineEditor(in io.Reader, out io.Writer, h *history, complete func(string) []string) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out, history: h, complete: complete}
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.line = nil
+	e.cursor = 0
+	e.historyIndex = len(e.history.entries)
+	e.lastKey = 0
+
+	if err := e.refresh(); err != nil {
+		return "", err
+	}
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			return e.submit()
+		case keyCtrlC:
+			_, err = io.WriteString(e.out, "^C\r\n")
+			if err != nil {
+				return "", err
+			}
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				_, err = io.WriteString(e.out, "\r\n")
+				if err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			e.deleteRange(e.cursor, e.cursor+1)
+		case keyCtrlA, keyHome:
+			e.cursor = 0
+		case keyCtrlE, keyEnd:
+			e.cursor = len(e.line)
+		case keyCtrlB, keyLeft:
+			e.cursor = max(e.cursor-1, 0)
+		case keyCtrlF, keyRight:
+			e.cursor = min(e.cursor+1, len(e.line))
+		case keyBackspace, keyDelete:
+			e.deleteRange(e.cursor-1, e.cursor)
+		case keyDeleteForward:
+			e.deleteRange(e.cursor, e.cursor+1)
+		case keyCtrlK:
+			e.deleteRange(e.cursor, len(e.line))
+		case keyCtrlU:
+			e.deleteRange(0, e.cursor)
+		case keyCtrlW:
+			start := e.cursor
+			for start > 0 && unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			e.deleteRange(start, e.cursor)
+		case keyCtrlP, keyUp:
+			e.browseHistory(-1)
+		case keyCtrlN, keyDown:
+			e.browseHistory(1)
+		case keyCtrlL:
+			if _, err := io.WriteString(e.out, "\x1b[H\x1b[2J"); err != nil {
+				return "", err
+			}
+		case keyCtrlR:
+			submit, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if submit {
+				return e.submit()
+			}
+		case keyTab:
+			if err := e.completeWord(); err != nil {
+				return "", err
+			}
+		default:
+			if key >= ' ' && key <= unicode.MaxRune {
+				e.insert(key)
+			}
+		}
+
+		e.lastKey = key
+
+		if err := e.refresh(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// readKey reads a rune, or an escape sequence as one of the keys beyond the
+// range of runes.
+func (e *lineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+
+	var parameter strings.Builder
+
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r < '0' || r > '9' && r != ';' {
+			break
+		}
+		parameter.WriteRune(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch parameter.String() {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDeleteForward, nil
+		}
+	}
+
+	return keyUnknown, nil
+}
+
+func (e *lineEditor) submit() (string, error) {
+	line := string(e.line)
+
+	if _, err := io.WriteString(e.out, "\r\n"); err != nil {
+		return "", err
+	}
+
+	// The session goes on if the history cannot be saved.
+	_ = e.history.add(line)
+	return line, nil
+}
+
+func (e *lineEditor) insert(runes ...rune) {
+	e.line = append(e.line[:e.cursor], append(runes, e.line[e.cursor:]...)...)
+	e.cursor += len(runes)
+}
+
+func (e *lineEditor) deleteRange(start, end int) {
+	start = max(start, 0)
+	end = min(end, len(e.line))
+
+	if start >= end {
+		return
+	}
+
+	e.line = append(e.line[:start], e.line[end:]...)
+	e.cursor = start
+}
+
+// refresh redraws the line and moves the cursor to its position.
+func (e *lineEditor) refresh() error {
+	var b strings.Builder
+
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	if e.highlight != nil {
+		b.WriteString(e.highlight(string(e.line)))
+	} else {
+		b.WriteString(string(e.line))
+	}
+	b.WriteString("\x1b[K")
+
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+
+	_, err := io.WriteString(e.out, b.String())
+	return err
+}
+
+// browseHistory replaces the line with the entry of the history offset
+// from the current one, keeping the new line aside.
+func (e *lineEditor) browseHistory(offset int) {
+	index := e.historyIndex + offset
+	entries := e.history.entries
+
+	if index < 0 || index > len(entries) {
+		return
+	}
+
+	if e.historyIndex == len(entries) {
+		e.draft = e.line
+	}
+
+	e.historyIndex = index
+
+	if index == len(entries) {
+		e.line = e.draft
+	} else {
+		e.line = []rune(entries[index])
+	}
+
+	e.cursor = len(e.line)
+}
+
+// reverseSearch searches the history for the most recent entry containing
+// the text typed, or the ones before with Ctrl-R. Enter submits the match,
+// Ctrl-G and Ctrl-C restore the line, and any other key edits the match.
+func (e *lineEditor) reverseSearch() (bool, error) {
+	var query []rune
+	entries := e.history.entries
+	match := len(entries)
+
+	find := func(from int) {
+		for i := min(from, len(entries)-1); i >= 0; i-- {
+			if strings.Contains(entries[i], string(query)) {
+				match = i
+				return
+			}
+		}
+	}
+
+	for {
+		found := ""
+		if match < len(entries) {
+			found = entries[match]
+		}
+
+		_, err := fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), found)
+		if err != nil {
+			return false, err
+		}
+
+		key, _, err := e.in.ReadRune()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case key == keyCtrlR:
+			find(match - 1)
+		case key == keyBackspace || key == keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = len(entries)
+				find(match)
+			}
+		case key == keyCtrlG || key == keyCtrlC:
+			return false, nil
+		case key == keyEnter || key == keyLineFeed:
+			e.line = []rune(found)
+			return true, nil
+		case key >= ' ' && key != keyDelete:
+			query = append(query, key)
+			find(match)
+		default:
+			if match < len(entries) {
+				e.line = []rune(found)
+				e.cursor = len(e.line)
+			}
+			return false, e.in.UnreadRune()
+		}
+	}
+}
+
+// completeWord completes the identifier before the cursor, up to the
+// longest prefix shared by the candidates, which are listed when Tab is
+// pressed twice.
+func (e *lineEditor) completeWord() error {
+	start := e.cursor
+	for start > 0 && isIdentifierRune(e.line[start-1]) {
+		start--
+	}
+
+	prefix := string(e.line[start:e.cursor])
+	var candidates []string
+	if prefix != "" {
+		candidates = e.complete(prefix)
+	}
+
+	if len(candidates) == 0 {
+		_, err := io.WriteString(e.out, "\a")
+		return err
+	}
+
+	if common := commonPrefix(candidates); len(common) > len(prefix) {
+		e.insert([]rune(common[len(prefix):])...)
+		return nil
+	}
+
+	if e.lastKey != keyTab {
+		_, err := io.WriteString(e.out, "\a")
+		return err
+	}
+
+	_, err := fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return err
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	historyFilename = ".mandrill_history"
+	maxHistory      = 1000
+)
+
+// history holds the lines entered in this and previous sessions, which are
+// appended to a file unless its name is empty.
+type history struct {
+	entries  []string
+	filename string
+}
+
+// defaultHistoryFile returns the history file in the home directory, or an
+// empty name if there is none.
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFilename)
+}
+
+// loadHistory reads the most recent entries of the history file, starting
+// with an empty history if it cannot be read.
+func loadHistory(filename string) *history {
+	h := &history{filename: filename}
+
+	if filename == "" {
+		return h
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return h
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+
+	return h
+}
+
+// add records a line, unless it is blank or repeats the last one.
+func (h *history) add(line string) error {
+	if strings.TrimSpace(line) == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if h.filename == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(line + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
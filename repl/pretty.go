@@ -0,0 +1,204 @@
+package repl
+
+import (
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineWidth is the width up to which arrays and maps are printed on one
+// line, beyond which their elements are printed on lines of their own.
+const maxLineWidth = 60
+
+// ANSI escape sequences used to colour values and code.
+const (
+	colourReset   = "\x1b[0m"
+	colourRed     = "\x1b[31m"
+	colourGreen   = "\x1b[32m"
+	colourYellow  = "\x1b[33m"
+	colourBlue    = "\x1b[34m"
+	colourMagenta = "\x1b[35m"
+	colourCyan    = "\x1b[36m"
+)
+
+// printer formats the values of a session, coloured by type if colour is set.
+type printer struct {
+	colour bool
+}
+
+// format returns obj as printed by the REPL: strings are printed as they are
+// at the top level but quoted inside arrays and maps, which are indented
+// when they do not fit on a line.
+func (p printer) format(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return p.paint(colourGreen, str.Value)
+	}
+
+	var b strings.Builder
+	p.write(&b, obj, "")
+	return b.String()
+}
+
+func (p printer) write(b *strings.Builder, obj object.Object, indent string) {
+	var elements []object.Object
+	var keys []object.Object
+	open, close := "[", "]"
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		elements = obj.Elements
+	case *object.Map:
+		open, close = "{", "}"
+		for _, pair := range sortedPairs(obj) {
+			keys = append(keys, pair.Key)
+			elements = append(elements, pair.Value)
+		}
+	default:
+		b.WriteString(p.scalar(obj))
+		return
+	}
+
+	plain := printer{}
+	multiline := len(indent)+utf8.RuneCountInString(plain.flat(obj)) > maxLineWidth
+
+	b.WriteString(open)
+
+	for i, element := range elements {
+		switch {
+		case multiline:
+			b.WriteString("\n" + indent + "  ")
+		case i > 0:
+			b.WriteString(" ")
+		}
+
+		if keys != nil {
+			p.write(b, keys[i], indent+"  ")
+			b.WriteString(": ")
+		}
+		p.write(b, element, indent+"  ")
+
+		if i < len(elements)-1 {
+			b.WriteString(",")
+		}
+	}
+
+	if multiline && len(elements) > 0 {
+		b.WriteString("\n" + indent)
+	}
+
+	b.WriteString(close)
+}
+
+// flat returns obj formatted on one line.
+func (p printer) flat(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Array:
+		var elements []string
+		for _, element := range obj.Elements {
+			elements = append(elements, p.flat(element))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.Map:
+		var pairs []string
+		for _, pair := range sortedPairs(obj) {
+			pairs = append(pairs, p.flat(pair.Key)+": "+p.flat(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return p.scalar(obj)
+	}
+}
+
+func (p printer) scalar(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return p.paint(colourGreen, strconv.Quote(obj.Value))
+	case *object.Integer, *object.Float:
+		return p.paint(colourYellow, obj.Inspect())
+	case *object.Boolean, *object.Null:
+		return p.paint(colourMagenta, obj.Inspect())
+	case *object.Function, *object.Builtin:
+		return p.paint(colourBlue, obj.Inspect())
+	case *object.Error:
+		return p.paint(colourRed, obj.Inspect())
+	default:
+		return obj.Inspect()
+	}
+}
+
+func (p printer) paint(colour, s string) string {
+	if !p.colour || colour == "" {
+		return s
+	}
+	return colour + s + colourReset
+}
+
+// sortedPairs returns the pairs of m ordered by their keys, so that maps
+// are printed the same way every time.
+func sortedPairs(m *object.Map) []object.MapPair {
+	var pairs []object.MapPair
+	for _, pair := range m.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Key.Type() != pairs[j].Key.Type() {
+			return pairs[i].Key.Type() < pairs[j].Key.Type()
+		}
+		if a, ok := pairs[i].Key.(*object.Integer); ok {
+			return a.Value < pairs[j].Key.(*object.Integer).Value
+		}
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+
+	return pairs
+}
+
+// highlight colours the tokens of a line of code by their type.
+func (p printer) highlight(line string) string {
+	l := lexer.NewLexer(line)
+
+	var b strings.Builder
+	var colour string
+	start := 0
+
+	for {
+		tok := l.NextToken()
+		end := min(tok.Position.Offset, len(line))
+
+		if end > start {
+			code := strings.TrimRight(line[start:end], " \t\r\n")
+			b.WriteString(p.paint(colour, code) + line[start+len(code):end])
+			start = end
+		}
+
+		if tok.Type == token.EOF {
+			break
+		}
+
+		colour = tokenColour(tok.Type)
+	}
+
+	return b.String()
+}
+
+func tokenColour(t token.TokenType) string {
+	switch t {
+	case token.STRING:
+		return colourGreen
+	case token.INT:
+		return colourYellow
+	case token.TRUE, token.FALSE, token.NULL:
+		return colourMagenta
+	case token.FUNCTION, token.LET, token.IF, token.ELSE, token.RETURN:
+		return colourCyan
+	case token.ILLEGAL:
+		return colourRed
+	default:
+		return ""
+	}
+}
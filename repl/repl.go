@@ -2,67 +2,238 @@ package repl
 
 import (
 	"bufio"
+	"errors"
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/diagnostic"
 	"example.com/writing-an-interpreter/evaluator"
 	"example.com/writing-an-interpreter/lexer"
 	"example.com/writing-an-interpreter/object"
 	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/token"
 	"io"
+	"os"
+	"sort"
 	"strings"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+// session holds the state kept between the lines of a REPL session.
+type session struct {
+	out io.Writer
+	env *object.Environment
+	// base is the environment enclosing env, with bindings that :reset
+	// keeps, or nil.
+	base        *object.Environment
+	interpreter *evaluator.Interpreter
+	printer     printer
+	// inputs are the inputs evaluated successfully, as saved by :save.
+	inputs []string
+	// sources are the source of the function literals parsed in the
+	// session, by their body.
+	sources map[*ast.BlockStatement]string
+}
+
+func newSession(out io.Writer, capabilities object.Capability) *session {
+	interpreter := evaluator.NewInterpreter()
+	interpreter.Out = out
+	interpreter.Capabilities = capabilities
+
+	return &session{
+		out:         out,
+		env:         object.NewEnvironment(),
+		interpreter: interpreter,
+		sources:     make(map[*ast.BlockStatement]string),
+	}
+}
+
+// Start runs a session reading lines from in until it ends. When in and out
+// are terminals, lines can be edited, searched in the history kept in the
+// home directory, and completed with Tab, and code and values are coloured
+// unless the NO_COLOR environment variable is set. The code evaluated is
+// granted capabilities.
+func Start(in io.Reader, out io.Writer, capabilities object.Capability) {
+	s := newSession(out, capabilities)
+
+	if err := s.loop(s.lineReader(in)); err != nil {
+		panic(err)
+	}
+}
 
+// loop runs the lines read by r until the input ends.
+func (s *session) loop(r lineReader) error {
 	for {
-		_, err := out.Write([]byte(PROMPT))
-		if err != nil {
-			panic(err)
+		line, err := r.readLine(PROMPT)
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.Is(err, errInterrupted):
+			continue
+		case err != nil:
+			return err
+		}
+
+		if err := s.run(line); err != nil {
+			return err
 		}
+	}
+}
+
+type lineReader interface {
+	// readLine prompts for a line and reads it, returning io.EOF once the
+	// input ends.
+	readLine(prompt string) (string, error)
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
 
-		scanned := scanner.Scan()
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	if _, err := io.WriteString(r.out, prompt); err != nil {
+		return "", err
+	}
 
-		if !scanned {
-			return
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
 		}
+		return "", io.EOF
+	}
 
-		line := scanner.Text()
-		l := lexer.NewLexer(line)
-		p := parser.NewParser(l)
-		program := p.ParseProgram()
-		result := evaluator.Eval(program, env)
+	return r.scanner.Text(), nil
+}
 
-		if len(p.Errors()) > 0 {
-			err := printParseErrors(out, p.Errors())
+// terminalReader edits lines with the terminal in raw mode, restoring its
+// mode while they are evaluated.
+type terminalReader struct {
+	fd     uintptr
+	editor *lineEditor
+}
 
-			if err != nil {
-				panic(err)
-			}
+func (r *terminalReader) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
 
-			continue
+	line, err := r.editor.readLine(prompt)
+
+	if restoreErr := restore(); err == nil {
+		err = restoreErr
+	}
+
+	return line, err
+}
+
+func (s *session) lineReader(in io.Reader) lineReader {
+	inFile, inOK := in.(*os.File)
+	outFile, outOK := s.out.(*os.File)
+
+	if inOK && outOK && isTerminal(inFile.Fd()) && isTerminal(outFile.Fd()) {
+		h := loadHistory(defaultHistoryFile())
+		editor := newLineEditor(in, s.out, h, s.completions)
+
+		if os.Getenv("NO_COLOR") == "" {
+			s.printer.colour = true
+			editor.highlight = s.printer.highlight
 		}
 
-		if result == nil {
-			continue
+		return &terminalReader{fd: inFile.Fd(), editor: editor}
+	}
+
+	return &scannerReader{scanner: bufio.NewScanner(in), out: s.out}
+}
+
+// completions returns the keywords, built-in functions and bindings of the
+// session starting with prefix.
+func (s *session) completions(prefix string) []string {
+	names := append(token.Keywords(), s.interpreter.BuiltinNames()...)
+	for name := range s.bindings() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var candidates []string
+	for i, name := range names {
+		if strings.HasPrefix(name, prefix) && (i == 0 || names[i-1] != name) {
+			candidates = append(candidates, name)
 		}
+	}
+
+	return candidates
+}
 
-		_, err = io.WriteString(out, result.Inspect()+"\n")
+// bindings returns the bindings visible in the session, including those of
+// the environment it was created with when served.
+func (s *session) bindings() map[string]object.Object {
+	bindings := make(map[string]object.Object)
 
-		if err != nil {
-			panic(err)
+	for env := s.env; env != nil; env = env.Outer() {
+		for name, value := range env.Bindings() {
+			if _, ok := bindings[name]; !ok {
+				bindings[name] = value
+			}
 		}
 	}
+
+	return bindings
+}
+
+// run executes a command, or passes a line through the stages of the REPL: it is parsed, then
+// validated, and only evaluated in the session environment if valid, so
+// that a line with errors cannot affect the session.
+func (s *session) run(line string) error {
+	if isCommand(line) {
+		return s.command(line)
+	}
+
+	program, diagnostics := parse(line)
+
+	if valid, err := s.validate(line, diagnostics); !valid {
+		return err
+	}
+
+	return s.evaluate(line, program)
+}
+
+func parse(line string) (*ast.Program, []diagnostic.Diagnostic) {
+	p := parser.NewParser(lexer.NewLexer(line))
+	program := p.ParseProgram()
+	return program, p.Diagnostics()
+}
+
+// validate reports whether a line parsed without errors, printing them
+// otherwise.
+func (s *session) validate(line string, diagnostics []diagnostic.Diagnostic) (bool, error) {
+	if len(diagnostics) == 0 {
+		return true, nil
+	}
+	return false, printParseErrors(s.out, line, diagnostics)
 }
 
-func printParseErrors(out io.Writer, errors []string) error {
-	messages := []string{
-		"Woops! We ran into some monkey business here!\n",
-		" parser errors:\n\t",
-		strings.Join(errors, "\n\t"),
-		"\n",
+func (s *session) evaluate(line string, program *ast.Program) error {
+	s.recordSources(line, program)
+	result := s.interpreter.Eval(program, s.env)
+
+	if _, ok := result.(*object.Error); !ok {
+		s.record(line)
+	}
+
+	if result == nil {
+		return nil
 	}
-	_, err := io.WriteString(out, strings.Join(messages, ""))
+
+	_, err := io.WriteString(s.out, s.printer.format(result)+"\n")
 	return err
 }
+
+func printParseErrors(out io.Writer, line string, diagnostics []diagnostic.Diagnostic) error {
+	_, err := io.WriteString(out, "Woops! We ran into some monkey business here!\n parser errors:\n")
+	if err != nil {
+		return err
+	}
+	return diagnostic.WriteText(out, "", line, diagnostics)
+}
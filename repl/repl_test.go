@@ -0,0 +1,596 @@
+package repl
+
+import (
+	"encoding/json"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runSession(input string) string {
+	var out strings.Builder
+	Start(strings.NewReader(input), &out, object.AllCapabilities)
+	return out.String()
+}
+
+func TestStart(t *testing.T) {
+	input := `let x = 2
+let add = fn(a, b) { a + b }
+add(x, 3)
+print("hello", x)
+x + true
+`
+
+	expected := `>> >> >> 5
+>> hello 2
+null
+>> ERROR: type mismatch: INTEGER + BOOLEAN
+>> `
+
+	if actual := runSession(input); actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestParseErrorsSkipEvaluation(t *testing.T) {
+	input := `let x = 1
+let x = 2 +
+let y x; print("evaluated")
+x
+`
+
+	actual := runSession(input)
+
+	expected := `>> >> Woops! We ran into some monkey business here!
+ parser errors:
+1:12: error[unexpected-token]: no prefixFn or infix parse function found for EOF
+    let x = 2 +
+               ^
+>> Woops! We ran into some monkey business here!
+ parser errors:
+1:7: error[missing-token]: Expected next token to be =, got IDENT instead
+    let y x; print("evaluated")
+          ^
+    fix: insert ` + "`=`" + `
+>> 1
+>> `
+
+	if actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "lib.mnd")
+	if err := os.WriteFile(filename, []byte("let double = fn(x) { x * 2 };\nlet ten = double(5);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":tokens let x = \"a\"", `1:1    LET       "let"
+1:5    IDENT     "x"
+1:7    =         "="
+1:9    STRING    "a"
+`},
+		{":ast -a + f(1)", `Program
+└── ExpressionStatement
+    └── InfixExpression +
+        ├── PrefixExpression -
+        │   └── Identifier a
+        └── CallExpression
+            ├── Identifier f
+            └── IntegerLiteral 1
+`},
+		{"let b = true\nlet a = [1]\n:env", "a: ARRAY = [1]\nb: BOOLEAN = true\n"},
+		{":type 1 + 2", "INTEGER\n"},
+		{":type {}", "MAP\n"},
+		{":type 1 + true", "ERROR: type mismatch: INTEGER + BOOLEAN\n"},
+		{"let x = 1\n:type let x = \"a\"\n:type let y = x\nx\ny", "NULL\nNULL\n1\nERROR: identifier not found: y\n"},
+		{":load " + filename + "\nten", "10\n"},
+		{"let a = 1\n:reset\n:env\na", "ERROR: identifier not found: a\n"},
+		{":type", "usage: :type <code>\n"},
+		{":nope", "unknown command :nope, type :help for a list of commands\n"},
+	}
+
+	for _, tt := range tests {
+		actual := runSession(tt.input)
+		// Leave out the prompts.
+		actual = strings.ReplaceAll(actual, PROMPT, "")
+
+		if actual != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, actual)
+		}
+	}
+
+	if help := runSession(":help"); !strings.Contains(help, ":load <file>") || !strings.Contains(help, ":reset") {
+		t.Errorf("help does not list the commands. got=%q", help)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		history  []string
+		keys     string
+		expected string
+	}{
+		{nil, "let x = 1\r", "let x = 1"},
+		// Ctrl-A, Ctrl-F, Ctrl-E and the arrow keys move the cursor.
+		{nil, "et\x01l\x05 x\x1b[D\x1b[Dy\r", "lety x"},
+		{nil, "ab\x01\x06\x06c\r", "abc"},
+		// Backspace, Ctrl-K, Ctrl-U and Ctrl-W delete text.
+		{nil, "abc\x7f\r", "ab"},
+		{nil, "abcd\x02\x02\x0b\r", "ab"},
+		{nil, "abcd\x02\x15\r", "d"},
+		{nil, "let x = \x17\x17y\r", "let y"},
+		// The up and down keys browse the history, keeping the new line.
+		{[]string{"first", "second"}, "\x1b[A\x1b[A\r", "first"},
+		{[]string{"first", "second"}, "new\x10\x0e\x0e\r", "new"},
+		// Ctrl-R searches the history backwards.
+		{[]string{"let a = 1", "let b = 2", "a + b"}, "\x12let\r", "let b = 2"},
+		{[]string{"let a = 1", "let b = 2", "a + b"}, "\x12let\x12\r", "let a = 1"},
+		{[]string{"let a = 1", "let b = 2"}, "\x12a =\x05;\r", "let a = 1;"},
+		{[]string{"let a = 1"}, "x\x12let\x07\r", "x"},
+		// Tab completes keywords, builtins and bindings.
+		{nil, "ret\t\r", "return"},
+		{nil, "let a = re\t\r", "let a = re"},
+		{nil, "red\t(\r", "reduce("},
+		{nil, "lengthy + le\t\r", "lengthy + le"},
+		{nil, "lengthy + leng\t\r", "lengthy + lengthy"},
+	}
+
+	for _, tt := range tests {
+		s := newSession(io.Discard, object.AllCapabilities)
+		if err := s.run("let lengthy = 1"); err != nil {
+			t.Fatal(err)
+		}
+
+		h := &history{entries: tt.history}
+		e := newLineEditor(strings.NewReader(tt.keys), io.Discard, h, s.completions)
+
+		actual, err := e.readLine(PROMPT)
+		if err != nil {
+			t.Errorf("readLine(%q) returned error: %v", tt.keys, err)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("wrong line for %q. expected=%q, got=%q", tt.keys, tt.expected, actual)
+		}
+	}
+}
+
+func TestLineEditorEndsInput(t *testing.T) {
+	e := newLineEditor(strings.NewReader("ab\x03\x04"), io.Discard, &history{}, nil)
+
+	if _, err := e.readLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C did not interrupt the line. got=%v", err)
+	}
+	if _, err := e.readLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D did not end the input. got=%v", err)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), historyFilename)
+
+	h := loadHistory(filename)
+	e := newLineEditor(strings.NewReader("let a = 1\r\r1 + 1\r1 + 1\r"), io.Discard, h, nil)
+	for i := 0; i < 4; i++ {
+		if _, err := e.readLine(PROMPT); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"let a = 1", "1 + 1"}
+	if actual := loadHistory(filename).entries; strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong history. expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a b"`, `a b`},
+		{`["a", "b\", 1, true]`, `["a", "b\\", 1, true]`},
+		{`{"b": [1, 2], "a": {}, 1: null}`, `{1: null, "a": {}, "b": [1, 2]}`},
+		{`[]`, `[]`},
+		{`let a = "some quite long string"; [a, a, {"nested": [a, a]}]`, `[
+  "some quite long string",
+  "some quite long string",
+  {
+    "nested": ["some quite long string", "some quite long string"]
+  }
+]`},
+	}
+
+	for _, tt := range tests {
+		actual := runSession(tt.input + "\n")
+		actual = strings.TrimSuffix(strings.ReplaceAll(actual, PROMPT, ""), "\n")
+
+		if actual != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, actual)
+		}
+	}
+
+	s := newSession(io.Discard, object.AllCapabilities)
+	s.printer.colour = true
+	if err := s.run(`let x = [1, "a", false]`); err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := s.env.Get("x")
+	expected := "[\x1b[33m1\x1b[0m, \x1b[32m\"a\"\x1b[0m, \x1b[35mfalse\x1b[0m]"
+	if actual := s.printer.format(x); actual != expected {
+		t.Errorf("wrong colours. expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	p := printer{colour: true}
+
+	expected := "\x1b[36mlet\x1b[0m x = \x1b[33m1\x1b[0m + \x1b[32m\"a\"\x1b[0m"
+	if actual := p.highlight(`let x = 1 + "a"`); actual != expected {
+		t.Errorf("wrong highlighting. expected=%q, got=%q", expected, actual)
+	}
+
+	if actual := (printer{}).highlight(`let x = 1`); actual != `let x = 1` {
+		t.Errorf("code coloured without colour. got=%q", actual)
+	}
+}
+
+func TestSnapshotLeavesOutBaseBindings(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "session.json")
+
+	var out strings.Builder
+	s := newSession(&out, object.AllCapabilities)
+	s.base = object.NewEnvironment()
+	s.base.Set("answer", &object.Integer{Value: 42})
+	s.env = object.NewEnclosedEnvironment(s.base)
+
+	for _, line := range []string{"let x = answer + 1", ":snapshot " + snapshot} {
+		if err := s.run(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["x"]; !ok || len(values) != 1 {
+		t.Errorf("expected only x to be saved. got=%s", data)
+	}
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "session.mnd")
+	snapshot := filepath.Join(dir, "session.json")
+
+	input := `let greeting = "say \\ hé"
+let nums = [1, 2, {"a": true, 3: null}]
+let twice = fn(f, x) { if (x > 0) { f(f(x)) } else { x } }
+let adder = fn(n) { fn(x) { x + n } }
+let add_two = adder(2)
+let broken = 1 +
+missing
+let partial = 1; partial + true
+let l = len
+:save ` + script + `
+:snapshot ` + snapshot + `
+`
+	out := runSession(input)
+	if !strings.Contains(out, "skipped l: BUILTIN values cannot be saved") {
+		t.Errorf("builtin not skipped. got=%q", out)
+	}
+	if !strings.Contains(out, "skipped add_two: closures cannot be saved") {
+		t.Errorf("closure not skipped. got=%q", out)
+	}
+
+	saved, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `let greeting = "say \\ hé";
+let nums = [1, 2, {"a": true, 3: null}];
+let twice = fn(f, x) { if (x > 0) { f(f(x)) } else { x } };
+let adder = fn(n) { fn(x) { x + n } };
+let add_two = adder(2);
+let l = len;
+`
+	if string(saved) != expected {
+		t.Errorf("wrong script.\nexpected:\n%s\ngot:\n%s", expected, saved)
+	}
+
+	input = `:restore ` + snapshot + `
+greeting
+nums
+twice(fn(x) { x * 3 }, 2)
+adder(1)(2)
+add_two
+l
+:restore ` + filepath.Join(dir, "missing.json") + `
+`
+	actual := strings.ReplaceAll(runSession(input), PROMPT, "")
+	expected = `say \\ hé
+[1, 2, {3: null, "a": true}]
+18
+3
+ERROR: identifier not found: add_two
+ERROR: identifier not found: l
+cannot restore ` + filepath.Join(dir, "missing.json") + `: open ` + filepath.Join(dir, "missing.json") + `: no such file or directory
+`
+	if actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	// Only function literals are evaluated when restoring functions.
+	forged := filepath.Join(dir, "forged.json")
+	data := `{"f": {"type": "FUNCTION", "source": "print(\"evaluated\"); fn() { 1 }"}}`
+	if err := os.WriteFile(forged, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	actual = strings.ReplaceAll(runSession(":restore "+forged+"\nf\n"), PROMPT, "")
+	expected = "cannot restore " + forged + `: f: not a function: print("evaluated"); fn() { 1 }
+ERROR: identifier not found: f
+`
+	if actual != expected {
+		t.Errorf("wrong output for a forged snapshot.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestServe(t *testing.T) {
+	shared := object.NewEnvironment()
+	shared.Set("answer", &object.Integer{Value: 42})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{NewEnvironment: func() *object.Environment { return shared }, Token: "secret"}
+	done := make(chan error)
+	go func() {
+		done <- srv.Serve(listener)
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// Sessions run at the same time without seeing each other's bindings,
+	// and never bind names in the shared environment.
+	first, second := dial(), dial()
+	send(t, first, "secret\nlet x = answer + 1\nx\n")
+	send(t, second, "secret\nx\n")
+
+	expected := "token: Connected to Mandrill, type :help for a list of commands\n>> >> 43\n>> "
+	if actual := receive(t, first); actual != expected {
+		t.Errorf("wrong output of the first session.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	expected = "token: Connected to Mandrill, type :help for a list of commands\n>> ERROR: identifier not found: x\n>> "
+	if actual := receive(t, second); actual != expected {
+		t.Errorf("wrong output of the second session.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	if _, ok := shared.Get("x"); ok {
+		t.Errorf("session bound x in the shared environment")
+	}
+
+	rejected := dial()
+	send(t, rejected, "guess\nanswer\n")
+
+	if actual := receive(t, rejected); actual != "token: authentication failed\n" {
+		t.Errorf("wrong token accepted. got=%q", actual)
+	}
+
+	// Remote sessions are not granted the filesystem unless configured to.
+	conn := dial()
+	send(t, conn, "secret\n:env\n:reset\nanswer\n:load main.go\n")
+
+	expected = "token: Connected to Mandrill, type :help for a list of commands\n" +
+		">> answer: INTEGER = 42\n>> >> 42\n>> ERROR: `:load` needs filesystem access, which is not granted\n>> "
+	if actual := receive(t, conn); actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned error: %v", err)
+	}
+}
+
+func TestServeCopiesSharedValues(t *testing.T) {
+	xs := &object.Array{Elements: append(make([]object.Object, 0, 4), &object.Integer{Value: 1})}
+	key := &object.String{Value: "xs"}
+
+	shared := object.NewEnvironment()
+	shared.Set("xs", xs)
+	shared.Set("m", &object.Map{Pairs: map[object.HashKey]object.MapPair{key.HashKey(): {Key: key, Value: xs}}})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go Serve(listener, func() *object.Environment { return shared })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(t, conn, "append(xs, 2)\nappend(m[\"xs\"], 3)\n")
+
+	expected := "Connected to Mandrill, type :help for a list of commands\n>> [1, 2]\n>> [1, 3]\n>> "
+	if actual := receive(t, conn); actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	if spare := xs.Elements[:2][1]; spare != nil {
+		t.Errorf("a session wrote %s to the spare capacity of a shared array", spare.Inspect())
+	}
+}
+
+func TestServeIsolatesSharedFunctions(t *testing.T) {
+	shared := object.NewEnvironment()
+	program := parser.NewParser(lexer.NewLexer("let arr = append(append([1], 2), 3); let f = fn(x) { append(arr, x) };")).ParseProgram()
+	if err, ok := evaluator.NewInterpreter().Eval(program, shared).(*object.Error); ok {
+		t.Fatal(err.Inspect())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go Serve(listener, func() *object.Environment { return shared })
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// The second connection calls f between the first one's call and its
+	// use of the result.
+	first := dial()
+	if _, err := io.WriteString(first, "let mine = f(10);\n"); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the prompt that follows the evaluation.
+	prompts := ""
+	buf := make([]byte, 256)
+	for strings.Count(prompts, ">> ") < 2 {
+		n, err := first.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prompts += string(buf[:n])
+	}
+
+	second := dial()
+	send(t, second, "let theirs = f(20);\ntheirs\n")
+	expected := "Connected to Mandrill, type :help for a list of commands\n>> >> [1, 2, 3, 20]\n>> "
+	if actual := receive(t, second); actual != expected {
+		t.Errorf("wrong output for the second connection.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	send(t, first, "mine\n")
+	if actual := receive(t, first); actual != "[1, 2, 3, 10]\n>> " {
+		t.Errorf("wrong output for the first connection.\nexpected:\n%q\ngot:\n%q", "[1, 2, 3, 10]\n>> ", actual)
+	}
+}
+
+func TestServeAfterPanic(t *testing.T) {
+	shared := object.NewEnvironment()
+	shared.Set("crash", &object.Builtin{Fn: func(_ *object.BuiltinContext, _ ...object.Object) object.Object {
+		panic("crashed")
+	}})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go Serve(listener, func() *object.Environment { return shared })
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	first := dial()
+	send(t, first, "crash()\n2\n")
+
+	expected := "Connected to Mandrill, type :help for a list of commands\n>> internal error: crashed\n"
+	if actual := receive(t, first); actual != expected {
+		t.Errorf("wrong output of the crashed session.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	second := dial()
+	send(t, second, "1 + 2\n")
+
+	expected = "Connected to Mandrill, type :help for a list of commands\n>> 3\n>> "
+	if actual := receive(t, second); actual != expected {
+		t.Errorf("wrong output of the next session.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "repl.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+
+	go Serve(listener, object.NewEnvironment)
+
+	conn, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, conn, "1 + 2\n")
+
+	expected := "Connected to Mandrill, type :help for a list of commands\n>> 3\n>> "
+	if actual := receive(t, conn); actual != expected {
+		t.Errorf("wrong output.\nexpected:\n%q\ngot:\n%q", expected, actual)
+	}
+}
+
+// send writes input to conn, then closes it for writing.
+func send(t *testing.T, conn net.Conn, input string) {
+	t.Helper()
+
+	if _, err := io.WriteString(conn, input); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(interface{ CloseWrite() error }).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	defer conn.Close()
+
+	output, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
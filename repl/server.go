@@ -0,0 +1,162 @@
+package repl
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Server runs a REPL session for every connection it accepts, concurrently
+// and independently of the others.
+type Server struct {
+	// NewEnvironment returns the environment of the bindings visible to a
+	// new session. The session works on copies of the bindings, where
+	// arrays and maps are copied too and functions are bound to the copies,
+	// so that sessions sharing an environment cannot affect each other
+	// through it. Sessions start empty
+	// if it is nil.
+	NewEnvironment func() *object.Environment
+	// Token, if not empty, must be sent as the first line of a connection
+	// before anything can be evaluated.
+	Token string
+	// Capabilities are the capabilities granted to the sessions, none by
+	// default.
+	Capabilities object.Capability
+}
+
+// Serve runs a session for every connection accepted by listener, with the
+// bindings of the environment returned by envFactory, until listener is
+// closed.
+func Serve(listener net.Listener, envFactory func() *object.Environment) error {
+	srv := &Server{NewEnvironment: envFactory}
+	return srv.Serve(listener)
+}
+
+// Serve accepts connections until listener is closed. Sessions running when
+// it returns go on until their connection ends.
+func (srv *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			// The session cannot report errors but to its client.
+			_ = srv.serveConn(conn)
+		}()
+	}
+}
+
+func (srv *Server) serveConn(conn net.Conn) (err error) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// A bug of the interpreter ends the session, not the server.
+	defer func() {
+		if r := recover(); r != nil {
+			_, err = fmt.Fprintf(conn, "internal error: %v\n", r)
+		}
+	}()
+
+	r := &scannerReader{scanner: bufio.NewScanner(conn), out: conn}
+
+	if srv.Token != "" {
+		token, err := r.readLine("token: ")
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(srv.Token)) != 1 {
+			_, err = io.WriteString(conn, "authentication failed\n")
+			return err
+		}
+	}
+
+	s := newSession(conn, srv.Capabilities)
+
+	if srv.NewEnvironment != nil {
+		s.base = isolatedEnvironment(srv.NewEnvironment())
+		s.env = object.NewEnclosedEnvironment(s.base)
+	}
+
+	if _, err := fmt.Fprintln(conn, "Connected to Mandrill, type :help for a list of commands"); err != nil {
+		return err
+	}
+
+	return s.loop(r)
+}
+
+// isolatedEnvironment returns an environment with copies of the bindings of
+// env and its outer environments, so that a session cannot write to the
+// arrays and maps it shares with others, e.g. when append fills the spare
+// capacity of an array. Functions still see the environment they were
+// defined in.
+func isolatedEnvironment(env *object.Environment) *object.Environment {
+	var chain []*object.Environment
+	for e := env; e != nil; e = e.Outer() {
+		chain = append(chain, e)
+	}
+
+	isolated := object.NewEnvironment()
+	copies := make(map[any]any)
+	for _, e := range chain {
+		copies[e] = isolated
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		for name, value := range chain[i].Bindings() {
+			isolated.Set(name, copyValue(value, copies))
+		}
+	}
+
+	return isolated
+}
+
+// copyValue returns a copy of an array or a map and of the values it
+// contains, or obj itself for other values. A function defined in one of the
+// copied environments is bound to the isolated environment instead. copies
+// holds the values and environments already copied, so that each one is
+// copied once.
+func copyValue(obj object.Object, copies map[any]any) object.Object {
+	if c, ok := copies[obj]; ok {
+		return c.(object.Object)
+	}
+
+	switch o := obj.(type) {
+	case *object.Array:
+		c := &object.Array{Elements: make([]object.Object, len(o.Elements))}
+		copies[o] = c
+		for i, e := range o.Elements {
+			c.Elements[i] = copyValue(e, copies)
+		}
+		return c
+	case *object.Map:
+		c := &object.Map{Pairs: make(map[object.HashKey]object.MapPair, len(o.Pairs))}
+		copies[o] = c
+		for key, pair := range o.Pairs {
+			c.Pairs[key] = object.MapPair{Key: copyValue(pair.Key, copies), Value: copyValue(pair.Value, copies)}
+		}
+		return c
+	case *object.Function:
+		env, ok := copies[o.Environment]
+		if !ok {
+			return obj
+		}
+		c := &object.Function{Parameters: o.Parameters, Body: o.Body, Environment: env.(*object.Environment)}
+		copies[o] = c
+		return c
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,332 @@
+package repl
+
+import (
+	"encoding/json"
+	"errors"
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// record keeps the input of a successful evaluation so that the session can
+// be saved as a script. Inputs that fail are left out even when they bound
+// names before failing, as replaying them would stop the script.
+func (s *session) record(input string) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+	if !strings.HasSuffix(input, ";") {
+		// Keep the next input from continuing the expression.
+		input += ";"
+	}
+	s.inputs = append(s.inputs, input)
+}
+
+// recordSources keeps the source of the function literals of a program
+// parsed from input, for the functions created from them to be saved in
+// snapshots as written.
+func (s *session) recordSources(input string, node ast.Node) {
+	if fl, ok := node.(*ast.FunctionLiteral); ok {
+		if source, ok := functionSource(input, fl); ok {
+			s.sources[fl.Body] = source
+		}
+	}
+
+	for _, child := range ast.Children(node) {
+		s.recordSources(input, child)
+	}
+}
+
+// functionSource returns the text of input from the fn keyword of fl to the
+// brace that closes its body.
+func functionSource(input string, fl *ast.FunctionLiteral) (string, bool) {
+	start, body := fl.Token.Position.Offset, fl.Body.Token.Position.Offset
+	if start > body || body >= len(input) {
+		return "", false
+	}
+
+	l := lexer.NewLexer(input[body:])
+	depth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return input[start : body+tok.Position.Offset+1], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (s *session) save(filename string) error {
+	if granted, err := s.requireFilesystem("save"); !granted {
+		return err
+	}
+
+	script := strings.Join(s.inputs, "\n")
+	if script != "" {
+		script += "\n"
+	}
+
+	if err := os.WriteFile(filename, []byte(script), 0o644); err != nil {
+		_, err = fmt.Fprintln(s.out, err)
+		return err
+	}
+
+	return nil
+}
+
+// snapshotValue is a value of a snapshot, of which a function is kept as its
+// source and evaluated again when restored.
+type snapshotValue struct {
+	Type     object.ObjectType `json:"type"`
+	Value    json.RawMessage   `json:"value,omitempty"`
+	Elements []snapshotValue   `json:"elements,omitempty"`
+	Pairs    []snapshotPair    `json:"pairs,omitempty"`
+	Source   string            `json:"source,omitempty"`
+}
+
+type snapshotPair struct {
+	Key   snapshotValue `json:"key"`
+	Value snapshotValue `json:"value"`
+}
+
+// snapshot writes the bindings made in the session to a file as JSON,
+// leaving out those of the environment it was created with, which a
+// restoring session has its own version of. Values that cannot be saved,
+// such as built-in functions and closures, are left out with a warning.
+func (s *session) snapshot(filename string) error {
+	if granted, err := s.requireFilesystem("snapshot"); !granted {
+		return err
+	}
+
+	bindings := s.env.Bindings()
+	names := make([]string, 0, len(bindings))
+
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]snapshotValue, len(bindings))
+
+	for _, name := range names {
+		value, err := s.encode(bindings[name])
+		if err != nil {
+			if _, err := fmt.Fprintf(s.out, "skipped %s: %s\n", name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		values[name] = value
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filename, append(data, '\n'), 0o644)
+	}
+
+	if err != nil {
+		_, err = fmt.Fprintln(s.out, err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *session) encode(obj object.Object) (snapshotValue, error) {
+	value := snapshotValue{Type: obj.Type()}
+	var err error
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		value.Value, err = json.Marshal(obj.Value)
+	case *object.Float:
+		value.Value, err = json.Marshal(obj.Value)
+	case *object.String:
+		value.Value, err = json.Marshal(obj.Value)
+	case *object.Boolean:
+		value.Value, err = json.Marshal(obj.Value)
+	case *object.Null:
+	case *object.Array:
+		value.Elements = make([]snapshotValue, 0, len(obj.Elements))
+		for _, element := range obj.Elements {
+			encoded, err := s.encode(element)
+			if err != nil {
+				return value, err
+			}
+			value.Elements = append(value.Elements, encoded)
+		}
+	case *object.Map:
+		value.Pairs = make([]snapshotPair, 0, len(obj.Pairs))
+		for _, pair := range sortedPairs(obj) {
+			key, err := s.encode(pair.Key)
+			if err != nil {
+				return value, err
+			}
+			encoded, err := s.encode(pair.Value)
+			if err != nil {
+				return value, err
+			}
+			value.Pairs = append(value.Pairs, snapshotPair{Key: key, Value: encoded})
+		}
+	case *object.Function:
+		// Only the source of a function is saved, so a closure would lose
+		// the bindings it captured.
+		if obj.Environment != s.env && obj.Environment != s.base {
+			return value, errors.New("closures cannot be saved")
+		}
+		source, ok := s.sources[obj.Body]
+		if !ok {
+			source = obj.Inspect()
+		}
+		value.Source = source
+	default:
+		err = fmt.Errorf("%s values cannot be saved", obj.Type())
+	}
+
+	return value, err
+}
+
+// restore adds the bindings of a snapshot to the session, replacing those
+// with the same names. Functions are evaluated again in the session
+// environment.
+func (s *session) restore(filename string) error {
+	if granted, err := s.requireFilesystem("restore"); !granted {
+		return err
+	}
+
+	restored, err := s.readSnapshot(filename)
+
+	if err != nil {
+		_, err = fmt.Fprintf(s.out, "cannot restore %s: %s\n", filename, err)
+		return err
+	}
+
+	for name, value := range restored {
+		s.env.Set(name, value)
+	}
+
+	return nil
+}
+
+func (s *session) readSnapshot(filename string) (map[string]object.Object, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]snapshotValue
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	restored := make(map[string]object.Object, len(values))
+
+	for name, value := range values {
+		if restored[name], err = s.decode(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return restored, nil
+}
+
+func (s *session) decode(value snapshotValue) (object.Object, error) {
+	var err error
+
+	switch value.Type {
+	case object.INTEGER:
+		integer := &object.Integer{}
+		err = json.Unmarshal(value.Value, &integer.Value)
+		return integer, err
+	case object.FLOAT:
+		float := &object.Float{}
+		err = json.Unmarshal(value.Value, &float.Value)
+		return float, err
+	case object.STRING:
+		str := &object.String{}
+		err = json.Unmarshal(value.Value, &str.Value)
+		return str, err
+	case object.BOOLEAN:
+		var b bool
+		err = json.Unmarshal(value.Value, &b)
+		if b {
+			return evaluator.TRUE, err
+		}
+		return evaluator.FALSE, err
+	case object.NULL:
+		return evaluator.NULL, nil
+	case object.ARRAY:
+		array := &object.Array{Elements: make([]object.Object, 0, len(value.Elements))}
+		for _, element := range value.Elements {
+			decoded, err := s.decode(element)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, decoded)
+		}
+		return array, nil
+	case object.MAP:
+		m := &object.Map{Pairs: make(map[object.HashKey]object.MapPair, len(value.Pairs))}
+		for _, pair := range value.Pairs {
+			key, err := s.decode(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as map key: %s", key.Type())
+			}
+			decoded, err := s.decode(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			m.Pairs[hashable.HashKey()] = object.MapPair{Key: key, Value: decoded}
+		}
+		return m, nil
+	case object.FUNCTION:
+		program, diagnostics := parse(value.Source)
+		if len(diagnostics) > 0 {
+			return nil, errors.New(diagnostics[0].Message)
+		}
+		// The source is evaluated, so it must not be anything else than
+		// a function literal.
+		if !isFunctionLiteral(program) {
+			return nil, fmt.Errorf("not a function: %s", value.Source)
+		}
+		s.recordSources(value.Source, program)
+
+		fn, ok := s.interpreter.Eval(program, s.env).(*object.Function)
+		if !ok {
+			return nil, fmt.Errorf("not a function: %s", value.Source)
+		}
+		return fn, nil
+	default:
+		return nil, fmt.Errorf("%s values cannot be restored", value.Type)
+	}
+}
+
+func isFunctionLiteral(program *ast.Program) bool {
+	if len(program.Statements) != 1 {
+		return false
+	}
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, ok = statement.Expression.(*ast.FunctionLiteral)
+	return ok
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package repl
+
+import "errors"
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
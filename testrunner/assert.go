@@ -0,0 +1,213 @@
+package testrunner
+
+import (
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/object"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// assertions is the module of built-in functions enabled for tests.
+var assertions = &evaluator.Module{Name: "testing", Builtins: map[string]*object.Builtin{
+	"assert":       object.SimpleBuiltin(assert),
+	"assert_eq":    object.SimpleBuiltin(assertEq),
+	"assert_error": {Fn: assertError},
+}}
+
+func assert(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("assert expects a condition and an optional message, received %d arguments", len(args))
+	}
+
+	condition, ok := args[0].(*object.Boolean)
+	if !ok {
+		return newError("assert expects a BOOLEAN condition, got %s", args[0].Type())
+	}
+
+	if condition.Value {
+		return evaluator.NULL
+	}
+
+	if len(args) == 2 {
+		return newError("assertion failed: %s", args[1].Inspect())
+	}
+	return newError("assertion failed")
+}
+
+func assertEq(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("assert_eq expects 2 arguments, received %d", len(args))
+	}
+
+	actual, expected := args[0], args[1]
+	if equal(actual, expected) {
+		return evaluator.NULL
+	}
+
+	var out strings.Builder
+	out.WriteString("assert_eq failed")
+
+	actualString, actualIsString := actual.(*object.String)
+	expectedString, expectedIsString := expected.(*object.String)
+
+	if actualIsString && expectedIsString &&
+		(strings.Contains(actualString.Value, "\n") || strings.Contains(expectedString.Value, "\n")) {
+		out.WriteString(" (-expected +actual):")
+		for _, line := range diff(strings.Split(expectedString.Value, "\n"), strings.Split(actualString.Value, "\n")) {
+			out.WriteString("\n" + line)
+		}
+	} else {
+		out.WriteString(":\nexpected: " + format(expected))
+		out.WriteString("\nactual:   " + format(actual))
+	}
+
+	return newError("%s", out.String())
+}
+
+func assertError(ctx *object.BuiltinContext, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("assert_error expects a function and an optional message, received %d arguments", len(args))
+	}
+
+	var substring string
+	if len(args) == 2 {
+		s, ok := args[1].(*object.String)
+		if !ok {
+			return newError("assert_error expects a STRING message, got %s", args[1].Type())
+		}
+		substring = s.Value
+	}
+
+	result := ctx.Apply(args[0])
+	err, ok := result.(*object.Error)
+
+	switch {
+	case !ok && result == nil:
+		return newError("assert_error failed: expected an error, got nothing")
+	case !ok:
+		return newError("assert_error failed: expected an error, got %s", format(result))
+	case !strings.Contains(err.Message, substring):
+		return newError("assert_error failed: expected an error containing %s, got %s",
+			strconv.Quote(substring), strconv.Quote(err.Message))
+	}
+
+	return evaluator.NULL
+}
+
+func newError(format string, a ...any) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// equal reports whether two values are deeply equal.
+func equal(a object.Object, b object.Object) bool {
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return a == b
+	}
+
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Map:
+		other := b.(*object.Map)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !equal(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// format returns a deterministic representation of value, quoting strings
+// and sorting map keys, so that failures are easy to compare.
+func format(value object.Object) string {
+	switch v := value.(type) {
+	case nil:
+		return "nothing"
+	case *object.String:
+		return strconv.Quote(v.Value)
+	case *object.Array:
+		elements := make([]string, len(v.Elements))
+		for i, e := range v.Elements {
+			elements[i] = format(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.Map:
+		var pairs []string
+		for _, pair := range v.Pairs {
+			pairs = append(pairs, format(pair.Key)+": "+format(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return value.Inspect()
+	}
+}
+
+// diff returns the lines of expected and actual prefixed with "-" when they
+// are only in expected, "+" when they are only in actual and " " otherwise.
+func diff(expected []string, actual []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// expected[i:] and actual[j:].
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			lines = append(lines, " "+expected[i])
+			i++
+			j++
+		case j == len(actual) || (i < len(expected) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+expected[i])
+			i++
+		default:
+			lines = append(lines, "+"+actual[j])
+			j++
+		}
+	}
+
+	return lines
+}
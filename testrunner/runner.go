@@ -0,0 +1,223 @@
+package testrunner
+
+import (
+	"example.com/writing-an-interpreter/ast"
+	"example.com/writing-an-interpreter/evaluator"
+	"example.com/writing-an-interpreter/lexer"
+	"example.com/writing-an-interpreter/object"
+	"example.com/writing-an-interpreter/parser"
+	"example.com/writing-an-interpreter/token"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	fileSuffix = "_test.mnd"
+	testPrefix = "test_"
+)
+
+// Result is the outcome of a single test function.
+type Result struct {
+	Name     string
+	Passed   bool
+	Position token.Position // where the test failed
+	Message  string
+}
+
+// FileResult holds the results of the tests of a file. Err is set when the
+// file could not be read, parsed or evaluated, in which case no test is run.
+type FileResult struct {
+	Filename string
+	Err      error
+	Results  []Result
+}
+
+func (fr FileResult) Passed() bool {
+	if fr.Err != nil {
+		return false
+	}
+
+	for _, r := range fr.Results {
+		if !r.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FindFiles returns the test files matched by patterns. A pattern is a test
+// file, a directory, whose test files are matched, or a directory followed
+// by "/...", whose test files are matched recursively.
+func FindFiles(patterns []string) ([]string, error) {
+	var files []string
+
+	for _, pattern := range patterns {
+		if dir, ok := strings.CutSuffix(pattern, "..."); ok {
+			if dir = strings.TrimSuffix(dir, "/"); dir == "" {
+				dir = "."
+			}
+
+			err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && strings.HasSuffix(path, fileSuffix) {
+					files = append(files, path)
+				}
+				return nil
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(pattern, "*"+fileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// RunFile runs the tests of a file, with the given capabilities granted.
+func RunFile(filename string, capabilities object.Capability) FileResult {
+	source, err := os.ReadFile(filename)
+
+	if err != nil {
+		return FileResult{Filename: filename, Err: err}
+	}
+
+	return RunSource(filename, string(source), capabilities)
+}
+
+// RunSource runs every test function of source, the contents of filename.
+// Test functions are the top-level let statements binding a function with
+// no parameters to a name starting with "test_". Each one is run after
+// evaluating the file in a fresh environment, so that tests cannot affect
+// each other, with the given capabilities granted.
+func RunSource(filename string, source string, capabilities object.Capability) FileResult {
+	fr := FileResult{Filename: filename}
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, filename+":"+d.Error())
+		}
+		fr.Err = fmt.Errorf("parser errors:\n\t%s", strings.Join(messages, "\n\t"))
+		return fr
+	}
+
+	for _, name := range testNames(program) {
+		env, in := newTestEnvironment(capabilities)
+		result := in.Eval(program, env)
+
+		if err, ok := result.(*object.Error); ok {
+			fr.Err = fmt.Errorf("%s:%d:%d: %s", filename, err.Position.Line, err.Position.Column, err.Message)
+			return fr
+		}
+
+		fn, _ := env.Get(name)
+		r := Result{Name: name, Passed: true}
+
+		if err, ok := in.Apply(fn).(*object.Error); ok {
+			r.Passed = false
+			r.Position = err.Position
+			r.Message = err.Message
+		}
+
+		fr.Results = append(fr.Results, r)
+	}
+
+	return fr
+}
+
+func testNames(program *ast.Program) []string {
+	var names []string
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, testPrefix) {
+			continue
+		}
+
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok && len(fn.Parameters) == 0 {
+			names = append(names, let.Name.Value)
+		}
+	}
+
+	return names
+}
+
+func newTestEnvironment(capabilities object.Capability) (*object.Environment, *evaluator.Interpreter) {
+	env := object.NewEnvironment()
+	in := evaluator.NewInterpreter()
+	in.Capabilities = capabilities
+	in.EnableModule(assertions)
+
+	return env, in
+}
+
+// Run runs the tests of every file, writing the failures to out, along with
+// the passing tests if verbose is set, and reports whether all passed.
+func Run(out io.Writer, filenames []string, verbose bool, capabilities object.Capability) bool {
+	passed := true
+
+	for _, filename := range filenames {
+		fr := RunFile(filename, capabilities)
+		WriteFileResult(out, fr, verbose)
+		passed = passed && fr.Passed()
+	}
+
+	return passed
+}
+
+func WriteFileResult(out io.Writer, fr FileResult, verbose bool) {
+	if fr.Err != nil {
+		fmt.Fprintf(out, "FAIL\t%s\n\t%s\n", fr.Filename, strings.ReplaceAll(fr.Err.Error(), "\n", "\n\t"))
+		return
+	}
+
+	failed := 0
+
+	for _, r := range fr.Results {
+		if r.Passed {
+			if verbose {
+				fmt.Fprintf(out, "--- PASS: %s\n", r.Name)
+			}
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(out, "--- FAIL: %s\n", r.Name)
+		fmt.Fprintf(out, "    %s:%d:%d: %s\n", fr.Filename, r.Position.Line, r.Position.Column,
+			strings.ReplaceAll(r.Message, "\n", "\n        "))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "FAIL\t%s\t%d of %d tests failed\n", fr.Filename, failed, len(fr.Results))
+	} else {
+		fmt.Fprintf(out, "ok  \t%s\t%d tests\n", fr.Filename, len(fr.Results))
+	}
+}
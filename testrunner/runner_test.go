@@ -0,0 +1,167 @@
+package testrunner
+
+import (
+	"bytes"
+	"example.com/writing-an-interpreter/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFile = `let add = fn(a, b) { a + b };
+let fail = fn() { 1 + true };
+
+let test_add = fn() {
+	assert_eq(add(1, 2), 3);
+	assert(add(1, 1) == 2, "one plus one");
+};
+
+let test_wrong_sum = fn() {
+	let sum = add(2, 2);
+	assert_eq(sum, 5);
+};
+
+let test_errors = fn() {
+	assert_error(fail, "type mismatch");
+	assert(false, "after an expected error");
+};
+
+let test_nested_error = fn() {
+	fail()
+};
+
+let helper = fn() { 1 };
+let test_with_argument = fn(x) { assert(false) };`
+
+func TestRunSource(t *testing.T) {
+	fr := RunSource("math_test.mnd", testFile, 0)
+
+	if fr.Err != nil {
+		t.Fatalf("unexpected error: %s", fr.Err)
+	}
+
+	expected := []Result{
+		{Name: "test_add", Passed: true},
+		{Name: "test_wrong_sum", Message: "assert_eq failed:\nexpected: 5\nactual:   4"},
+		{Name: "test_errors", Message: "assertion failed: after an expected error"},
+		{Name: "test_nested_error", Message: "type mismatch: INTEGER + BOOLEAN"},
+	}
+	expectedLines := []int{0, 11, 16, 2}
+
+	if len(fr.Results) != len(expected) {
+		t.Fatalf("wrong number of results. expected=%d, got=%d", len(expected), len(fr.Results))
+	}
+
+	for i, r := range fr.Results {
+		if r.Name != expected[i].Name || r.Passed != expected[i].Passed || r.Message != expected[i].Message {
+			t.Errorf("wrong result %d. expected=%+v, got=%+v", i, expected[i], r)
+		}
+		if r.Position.Line != expectedLines[i] {
+			t.Errorf("wrong line for %s. expected=%d, got=%d", r.Name, expectedLines[i], r.Position.Line)
+		}
+	}
+
+	if fr.Passed() {
+		t.Errorf("expected the file to fail")
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	fr := RunSource("isolation_test.mnd", `let counter = [];
+let test_first = fn() { let counter = append(counter, 1); assert_eq(len(counter), 1) };
+let test_second = fn() { assert_eq(counter, []) };`, 0)
+
+	if !fr.Passed() {
+		t.Errorf("expected the tests to pass, got %+v", fr)
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"let test_a = fn() { 1 };\nlet x = 1 + true;", "f_test.mnd:2:11: type mismatch: INTEGER + BOOLEAN"},
+		{"let test_a = fn( { 1 };", "parser errors:\n\tf_test.mnd:1:18:"},
+		{"let test_a = fn() { 1 };\nlet s = \"open;", "parser errors:\n\tf_test.mnd:2:9: unterminated string"},
+	}
+
+	for _, tt := range tests {
+		fr := RunSource("f_test.mnd", tt.source, 0)
+
+		if fr.Err == nil || !strings.HasPrefix(fr.Err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected prefix %q, got %v", tt.expected, fr.Err)
+		}
+	}
+}
+
+func TestAssertEqDiff(t *testing.T) {
+	result := assertEq(&object.String{Value: "a\nb\nc"}, &object.String{Value: "a\nc\nd"})
+
+	expected := "assert_eq failed (-expected +actual):\n a\n+b\n c\n-d"
+	if result.Inspect() != "ERROR: "+expected {
+		t.Errorf("wrong diff. expected=%q, got=%q", expected, result.Inspect())
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.mnd", "a.mnd", "sub/b_test.mnd"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("let test_a = fn() { assert(true) };"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{dir + "/...", []string{"a_test.mnd", "sub/b_test.mnd"}},
+		{dir, []string{"a_test.mnd"}},
+		{filepath.Join(dir, "sub", "b_test.mnd"), []string{"sub/b_test.mnd"}},
+	}
+
+	for _, tt := range tests {
+		files, err := FindFiles([]string{tt.pattern})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var relative []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(dir, f)
+			relative = append(relative, filepath.ToSlash(rel))
+		}
+
+		if !reflect.DeepEqual(relative, tt.expected) {
+			t.Errorf("wrong files for %q. expected=%v, got=%v", tt.pattern, tt.expected, relative)
+		}
+	}
+
+	var out bytes.Buffer
+	files, _ := FindFiles([]string{dir + "/..."})
+	if !Run(&out, files, true, 0) {
+		t.Errorf("expected the tests to pass, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "--- PASS: test_a\n") {
+		t.Errorf("verbose output does not list passing tests:\n%s", out.String())
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	source := `let test_clock = fn() { assert(now() > 0, "the clock is read") };`
+
+	if fr := RunSource("clock_test.mnd", source, 0); fr.Passed() || !strings.Contains(fr.Results[0].Message, "needs clock access") {
+		t.Errorf("expected the test to fail without clock access, got %+v", fr)
+	}
+
+	if fr := RunSource("clock_test.mnd", source, object.Clock); !fr.Passed() {
+		t.Errorf("expected the test to pass with clock access, got %+v", fr)
+	}
+}
@@ -1,10 +1,19 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Position Position
+}
+
+type Position struct {
+	Offset int `json:"offset"` // byte offset in the input, starting at 0
+	Line   int `json:"line"`   // starting at 1
+	Column int `json:"column"` // byte offset in the line, starting at 1
 }
 
 const (
@@ -70,3 +79,12 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+func Keywords() []string {
+	var words []string
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}